@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,11 +15,22 @@ import (
 	"strings"
 	"time"
 
+	"github.com/stuff7/mcman/cache"
 	"github.com/stuff7/mcman/slc"
 )
 
 var CF_KEY = os.Getenv("CURSEFORGE_KEY")
-var client = &http.Client{Transport: &cfTransport{}}
+var httpCache = cache.NewStore(
+	"cache",
+	time.Hour,
+	cache.Rule{Name: "search", Pattern: "/v1/mods/search", TTL: 10 * time.Minute},
+	cache.Rule{Name: "files", Pattern: "/v1/mods/*/files", TTL: time.Hour},
+	cache.Rule{Name: "changelog", Pattern: "/v1/mods/*/files/*/changelog", TTL: 24 * time.Hour},
+	cache.Rule{Name: "mod", Pattern: "/v1/mods/*", TTL: 6 * time.Hour},
+	cache.Rule{Name: "description", Pattern: "/v1/mods/*/description", TTL: 6 * time.Hour},
+	cache.Rule{Name: "versions", Pattern: "/v1/minecraft/version", TTL: 24 * time.Hour},
+)
+var client = &http.Client{Transport: &cache.Transport{Base: &cfTransport{}, Store: httpCache}}
 
 const MINECRAFT_ID = 432
 
@@ -29,7 +41,7 @@ func (t *cfTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.URL.Host = "api.curseforge.com"
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("x-api-key", CF_KEY)
-	return http.DefaultTransport.RoundTrip(req)
+	return retrying.RoundTrip(req)
 }
 
 func dumpHttp(r *http.Response, errs ...error) error {
@@ -61,10 +73,25 @@ func dumpJson(body []byte, errs ...error) error {
 	return errors.Join(errs...)
 }
 
-func getJSON[T any](ret *T, url string) error {
-	res, err := client.Get(url)
+func getJSON[T any](ctx context.Context, ret *T, url string) error {
+	var apiRes CfResponse[T]
+	if err := getResponse(ctx, &apiRes, url); err != nil {
+		return err
+	}
+
+	*ret = apiRes.Data
+	return nil
+}
+
+func getResponse[T any](ctx context.Context, apiRes *CfResponse[T], url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return dumpHttp(res, err)
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
 	}
 
 	if res.StatusCode != 200 {
@@ -77,26 +104,33 @@ func getJSON[T any](ret *T, url string) error {
 		return dumpHttp(res, err)
 	}
 
-	var apiRes CfResponse[T]
-	if err := json.Unmarshal(body, &apiRes); err != nil {
+	if err := json.Unmarshal(body, apiRes); err != nil {
 		return dumpHttp(res, dumpJson(body, err))
 	}
 
-	*ret = apiRes.Data
 	return nil
 }
 
-func downloadFile(url string, name string) (bool, error) {
+func downloadFile(ctx context.Context, url string, name string) (bool, error) {
 	if _, err := os.Stat(name); err == nil {
 		return false, nil
 	}
 
-	res, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := dlClient.Do(req)
 	if err != nil {
-		return false, dumpHttp(res, err)
+		return false, err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode != 200 {
+		return false, fmt.Errorf("Bad Response %s", res.Status)
+	}
+
 	file, err := os.Create(name)
 	if err != nil {
 		return true, err
@@ -105,6 +139,7 @@ func downloadFile(url string, name string) (bool, error) {
 
 	_, err = io.Copy(file, res.Body)
 	if err != nil {
+		os.Remove(name)
 		return true, err
 	}
 
@@ -205,6 +240,17 @@ var modLoaderKeywords = []string{
 	"NeoForge",
 }
 
+// CurseForge modLoaderType values, in the order of modLoaderKeywords
+const (
+	loaderAny = iota
+	loaderForge
+	loaderCauldron
+	loaderLiteLoader
+	loaderFabric
+	loaderQuilt
+	loaderNeoForge
+)
+
 type FileRelation int
 
 const (
@@ -224,6 +270,18 @@ const (
 	Alpha
 )
 
+func (r ReleaseType) String() string {
+	switch r {
+	case Release:
+		return "release"
+	case Beta:
+		return "beta"
+	case Alpha:
+		return "alpha"
+	}
+	return "unknown"
+}
+
 type Dependency struct {
 	ModId    int          `json:"modId"`
 	Relation FileRelation `json:"relationType"`
@@ -231,61 +289,122 @@ type Dependency struct {
 
 type modEntry struct {
 	Id          int       `json:"id"`
+	FileId      int       `json:"fileId"`
 	ModLoader   int       `json:"modLoader"`
 	GameVersion string    `json:"gameVersion"`
 	Name        string    `json:"name"`
 	DownloadUrl string    `json:"downloadUrl"`
 	Deps        []int     `json:"deps"`
 	Uploaded    time.Time `json:"uploaded"`
+	Stranded    bool      `json:"stranded,omitempty"`
+	Fallback    int       `json:"fallback,omitempty"`
+	Side        side      `json:"side,omitempty"`
+	Class       int       `json:"class,omitempty"`
+	Worlds      []string  `json:"worlds,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	Disabled    bool      `json:"disabled,omitempty"`
 }
 
-func appendModEntry(mods []modEntry, id int, query searchQuery, f *CfFile) []modEntry {
-	if !slices.ContainsFunc(mods, func(m modEntry) bool { return id == m.Id }) {
-		return append(mods, modEntry{
-			Id:          id,
-			ModLoader:   query.ModLoader,
-			GameVersion: query.GameVersion,
-			Name:        f.Name,
-			DownloadUrl: tryGetURL(f),
-			Uploaded:    f.Uploaded,
-			Deps: slc.Map(
-				slc.Filter(f.Dependencies, func(d Dependency) bool { return d.Relation == RequiredDependency }),
-				func(d Dependency) int { return d.ModId },
-			),
-		})
+// appendModEntry adds m with file f unless it is already there. loader is the
+// one f was found for, which differs from the entry's on a fallback.
+func appendModEntry(mods []modEntry, m modEntry, loader int, f *CfFile) []modEntry {
+	if !slices.ContainsFunc(mods, func(e modEntry) bool { return e.Id == m.Id }) {
+		m.setFile(f)
+		m.setLoader(loader)
+		return append(mods, m)
 	}
 	return mods
 }
 
+func (m *modEntry) setFile(f *CfFile) {
+	m.FileId = f.ID
+	m.Name = f.Name
+	m.DownloadUrl = tryGetURL(f)
+	m.Uploaded = f.Uploaded
+	m.Deps = requiredDeps(f)
+	m.Side = fileSide(f)
+	if m.Side == sideUnknown {
+		m.Side = classOf(m.Class).side
+	}
+}
+
+func (m *modEntry) setLoader(loader int) {
+	m.Fallback = 0
+	if loader != m.ModLoader {
+		m.Fallback = loader
+	}
+}
+
+// hasTag reports whether m is tagged with tag, ignoring case
+func (m modEntry) hasTag(tag string) bool {
+	return slices.ContainsFunc(m.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+func requiredDeps(f *CfFile) []int {
+	return slc.Map(
+		slc.Filter(f.Dependencies, func(d Dependency) bool { return d.Relation == RequiredDependency }),
+		func(d Dependency) int { return d.ModId },
+	)
+}
+
 func tryGetURL(f *CfFile) string {
 	if f.DownloadURL == nil {
-		fmt.Printf("%s! %sMissing Download URL for mod %+v. Trying to guess it%s\n", clr(227), BOLD, f.Name, RESET)
-		var ids [2]int
-		if f.ID > 999999 {
-			ids[0] = f.ID / 1000
-			ids[1] = f.ID % 1000
-		} else if f.ID > 99999 {
-			ids[0] = f.ID / 100
-			ids[1] = f.ID % 100
-		} else {
-			ids[0] = f.ID / 100
-			ids[1] = f.ID % 10
-		}
-
-		return fmt.Sprintf("%s%d/%03d/%s", downloadURL, ids[0], ids[1], url.QueryEscape(f.Name))
+		return guessURL(f)
 	}
 
 	return *f.DownloadURL
 }
 
-func listMods(mods []modEntry, filter func(m modEntry) bool) {
+// guessURL builds the CDN URL of a file whose author disabled third party
+// downloads from its id.
+func guessURL(f *CfFile) string {
+	var ids [2]int
+	if f.ID > 999999 {
+		ids[0] = f.ID / 1000
+		ids[1] = f.ID % 1000
+	} else if f.ID > 99999 {
+		ids[0] = f.ID / 100
+		ids[1] = f.ID % 100
+	} else {
+		ids[0] = f.ID / 100
+		ids[1] = f.ID % 10
+	}
+
+	return fmt.Sprintf("%s%d/%03d/%s", downloadURL, ids[0], ids[1], url.QueryEscape(f.Name))
+}
+
+// listMods prints the mods at idxs, with the stranded ones last
+func listMods(mods []modEntry, idxs []int) {
 	var count int
 	var sb strings.Builder
-	for i, m := range mods {
-		if filter == nil || filter(m) {
+	for _, stranded := range []bool{false, true} {
+		header := stranded
+		for _, i := range idxs {
+			m := mods[i]
+			if m.Stranded != stranded {
+				continue
+			}
+
+			if header {
+				sb.WriteString(fmt.Sprintf("\n%sStranded%s (no file for the current target)\n", clr(219)+BOLD, RESET))
+				header = false
+			}
+
 			count++
 			sb.WriteString(fmt.Sprintf("\n%s%03d%s %s%s%s # %s%d%s", clr(157)+BOLD, i, RESET, clr(214)+BOLD, m.Name, RESET, clr(157), m.Id, RESET))
-			sb.WriteString(fmt.Sprintf(" [%s%s %s%s%s]\n", clr(228)+BOLD, modLoaderKeywords[m.ModLoader], clr(231), m.GameVersion, RESET))
+			if class := classOf(m.Class); class.id != classMod {
+				sb.WriteString(fmt.Sprintf(" [%s%s %s%s%s]", clr(228)+BOLD, class.name, clr(231), m.GameVersion, RESET))
+			} else {
+				sb.WriteString(fmt.Sprintf(" [%s%s %s%s%s]", clr(228)+BOLD, modLoaderKeywords[m.ModLoader], clr(231), m.GameVersion, RESET))
+			}
+			if m.Fallback != 0 {
+				sb.WriteString(fmt.Sprintf(" %svia %s fallback%s", clr(45), modLoaderKeywords[m.Fallback], RESET))
+			}
+			if m.Disabled {
+				sb.WriteString(fmt.Sprintf(" %sdisabled%s", clr(248)+BOLD, RESET))
+			}
+			sb.WriteString("\n")
 			if len(m.Deps) > 0 {
 				deps := slc.Map(slc.Filter(mods, func(d modEntry) bool {
 					return slices.Contains(m.Deps, d.Id)
@@ -294,6 +413,16 @@ func listMods(mods []modEntry, filter func(m modEntry) bool) {
 				})
 				sb.WriteString(fmt.Sprintf("Deps:     %v\n", deps))
 			}
+			sb.WriteString(fmt.Sprintf("Side:     %s%s%s\n", clr(228), m.Side, RESET))
+			if len(m.Worlds) != 0 {
+				sb.WriteString(fmt.Sprintf("Worlds:   %s%s%s\n", clr(214), strings.Join(m.Worlds, ", "), RESET))
+			}
+			if len(m.Tags) != 0 {
+				sb.WriteString(fmt.Sprintf("Tags:     %s%s%s\n", clr(117), strings.Join(m.Tags, ", "), RESET))
+			}
+			if m.Note != "" {
+				sb.WriteString(fmt.Sprintf("Note:     %s\n", m.Note))
+			}
 			sb.WriteString(fmt.Sprintf("Download: %s%s%s\n", clr(123)+BOLD, m.DownloadUrl, RESET))
 			sb.WriteString(fmt.Sprintf("Uploaded: %s%s%s\n", clr(219)+BOLD, m.Uploaded.Format(time.RFC822), RESET))
 		}
@@ -319,12 +448,14 @@ func collectDeps(mods []modEntry, id int, rem *[]int) error {
 	return nil
 }
 
-func removeModEntry(mods *[]modEntry, idx int) error {
+// removeModEntry removes the mod at idx along with the dependencies nothing
+// else needs. The removed mod comes first in the returned entries.
+func removeModEntry(mods *[]modEntry, idx int) ([]modEntry, error) {
 	if idx < 0 || idx >= len(*mods) {
-		return fmt.Errorf("Not found")
+		return nil, fmt.Errorf("Not found")
 	}
 
-	mod := &(*mods)[idx]
+	mod := (*mods)[idx]
 	rem := append([]int{mod.Id}, mod.Deps...)
 	for i := 1; i < len(rem); i++ {
 		collectDeps(*mods, rem[i], &rem)
@@ -340,25 +471,22 @@ func removeModEntry(mods *[]modEntry, idx int) error {
 				continue
 			}
 			if mod.Id == r {
-				return fmt.Errorf("Cannot remove mod %#+v because other mods depend on it", mod.Name)
+				return nil, fmt.Errorf("Cannot remove mod %#+v because other mods depend on it", mod.Name)
 			}
 			rem = slices.Delete(rem, i, i+1)
 		}
 	}
 
+	removed := []modEntry{mod}
 	*mods = slc.Filter(*mods, func(m modEntry) bool {
 		remove := slices.Contains(rem, m.Id)
-		if remove {
-			if m.Id != mod.Id {
-				fmt.Printf("%s- Dep %s%s%s removed\n", clr(216), BOLD, m.Name, RESET)
-			} else {
-				fmt.Printf("%s- Mod %s%s%s removed\n", clr(219), BOLD, m.Name, RESET)
-			}
+		if remove && m.Id != mod.Id {
+			removed = append(removed, m)
 		}
 		return !remove
 	})
 
-	return nil
+	return removed, nil
 }
 
 type ModFiles struct {
@@ -377,7 +505,15 @@ type gameVersion struct {
 }
 
 type CfResponse[D any] struct {
-	Data D `json:"data"`
+	Data       D            `json:"data"`
+	Pagination cfPagination `json:"pagination"`
+}
+
+type cfPagination struct {
+	Index       int `json:"index"`
+	PageSize    int `json:"pageSize"`
+	ResultCount int `json:"resultCount"`
+	TotalCount  int `json:"totalCount"`
 }
 
 type CfFile struct {
@@ -402,6 +538,7 @@ type cfMod struct {
 	Modified      time.Time `json:"dateModified"`
 	Released      time.Time `json:"dateReleased"`
 	Files         []CfFile  `json:"latestFiles"`
+	Class         int       `json:"classId"`
 }
 
 type cfGameVersion struct {
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// handlerTransport serves requests with a handler instead of the network
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+// fakeCurseForge answers API requests with the data of routes, keyed by path,
+// game version and loader name as in "/v1/mods/1/files 1.20.1 Quilt", or by
+// path and game version, or by path alone. Other requests get a 404.
+func fakeCurseForge(t *testing.T, routes map[string]any) {
+	prev := client
+	client = &http.Client{Transport: handlerTransport{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path + " " + r.URL.Query().Get("gameVersion")
+		if loader, err := strconv.Atoi(r.URL.Query().Get("modLoaderType")); err == nil && loader < len(modLoaderKeywords) {
+			key += " " + modLoaderKeywords[loader]
+		}
+
+		data, ok := routes[key]
+		if !ok {
+			data, ok = routes[r.URL.Path+" "+r.URL.Query().Get("gameVersion")]
+		}
+		if !ok {
+			data, ok = routes[r.URL.Path]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(CfResponse[any]{Data: data})
+	})}}
+	t.Cleanup(func() { client = prev })
+}
+
+// newTestCli returns a cli with the default config working in a temporary
+// directory, which answers every question with answer.
+func newTestCli(t *testing.T, answer string) *cli {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := readLn
+	readLn = func(_ string, buf *string) error {
+		*buf = answer
+		return nil
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		readLn = prev
+	})
+
+	c := NewCli("> ")
+	c.config = defaultConfig()
+	return c
+}
+
+// run runs a command line the way the prompt does
+func (c *cli) run(t *testing.T, line string) error {
+	t.Helper()
+	cmd, _ := c.parseCmd(tokenize(line))
+	if cmd.Run == nil {
+		t.Fatalf("Unknown command %#+v", line)
+	}
+	return c.runCmd(cmd.run)
+}
+
+// captureStdout returns what fn prints
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	fn()
+	os.Stdout = prev
+	w.Close()
+	return string(<-done)
+}
+
+// fakeDownloads serves files, keyed by URL path, to downloads. Other files get
+// a 404.
+func fakeDownloads(t *testing.T, files map[string][]byte) {
+	prev := dlClient
+	dlClient = &http.Client{Transport: handlerTransport{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})}}
+	t.Cleanup(func() { dlClient = prev })
+}
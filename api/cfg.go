@@ -0,0 +1,260 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/stuff7/mcman/bitstream"
+	"github.com/stuff7/mcman/slc"
+)
+
+const cfgFile = "cfg"
+const cfgMagic = "MCCF"
+
+// Format versions of the cfg file. Version 0 is the original headerless
+// layout.
+const (
+	cfgV0 = iota
+	cfgV1
+)
+
+const cfgVersion = cfgV1
+
+// Field tags of the cfg v1 record
+const (
+	cfgModLoader = iota + 1
+	cfgGameVersion
+	cfgVersions
+	cfgAutosave
+	cfgFallbacks
+	cfgInstance
+	cfgMetaURL
+	cfgLoaderVersion
+)
+
+// config holds the settings persisted in the cfg file
+type config struct {
+	query    searchQuery
+	versions []string
+	autosave bool
+	// fallbacks maps a loader to the loaders whose files are used when it has
+	// none of its own, in order
+	fallbacks map[int][]int
+	// instance is the game directory download routes content into
+	instance string
+	// metaURL replaces the Fabric and Quilt meta servers, for mirrors and tests
+	metaURL       string
+	loaderVersion string
+}
+
+func defaultFallbacks() map[int][]int {
+	return map[int][]int{
+		loaderQuilt:    {loaderFabric},
+		loaderNeoForge: {loaderForge},
+	}
+}
+
+// fallbackLoaders returns the loaders with a fallback chain in a stable order.
+func (c *config) fallbackLoaders() []int {
+	loaders := make([]int, 0, len(c.fallbacks))
+	for l := range c.fallbacks {
+		loaders = append(loaders, l)
+	}
+	slices.Sort(loaders)
+	return loaders
+}
+
+func (c *config) fallbackString() string {
+	var chains []string
+	for _, l := range c.fallbackLoaders() {
+		if len(c.fallbacks[l]) != 0 {
+			chains = append(chains, strings.Join(slc.Map(append([]int{l}, c.fallbacks[l]...), func(l int) string { return modLoaderKeywords[l] }), " -> "))
+		}
+	}
+
+	if len(chains) == 0 {
+		return "none"
+	}
+	return strings.Join(chains, ", ")
+}
+
+func (c *cli) saveCfg() error {
+	var bs bitstream.Bitstream
+	writeHeader(&bs, cfgMagic, fileHeader{version: cfgVersion, count: 1})
+	writeRecord(&bs, func(rec *bitstream.Bitstream) {
+		writeUintField(rec, cfgModLoader, c.query.ModLoader)
+		writeStringField(rec, cfgGameVersion, c.query.GameVersion)
+
+		newVersions := c.versions
+		if idx := slices.Index(c.versions, memVersions[0]); idx != -1 {
+			newVersions = c.versions[:idx]
+		}
+		writeStringsField(rec, cfgVersions, newVersions)
+		if c.autosave {
+			writeUintField(rec, cfgAutosave, 1)
+		}
+		if c.instance != "" {
+			writeStringField(rec, cfgInstance, c.instance)
+		}
+		if c.metaURL != "" {
+			writeStringField(rec, cfgMetaURL, c.metaURL)
+		}
+		if c.loaderVersion != "" {
+			writeStringField(rec, cfgLoaderVersion, c.loaderVersion)
+		}
+		for _, loader := range c.fallbackLoaders() {
+			writeUintsField(rec, cfgFallbacks, append([]int{loader}, c.fallbacks[loader]...))
+		}
+	})
+
+	return saveFile(&bs, cfgFile)
+}
+
+func (c *cli) loadFiles() error {
+	if err := c.readMods(); err != nil {
+		return err
+	}
+
+	return c.readCfg()
+}
+
+func (c *cli) readCfg() error {
+	d, err := os.ReadFile(cfgFile)
+	if errors.Is(err, os.ErrNotExist) {
+		c.config = defaultConfig()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg, version, err := decodeCfg(d)
+	if err != nil {
+		return err
+	}
+
+	if version != cfgVersion {
+		if err := migrateFile(cfgFile, d, version, cfgVersion); err != nil {
+			return err
+		}
+	}
+
+	c.config = cfg
+	return nil
+}
+
+func defaultConfig() config {
+	return config{
+		query:     searchQuery{GameVersion: memVersions[0]},
+		versions:  memVersions,
+		fallbacks: defaultFallbacks(),
+	}
+}
+
+func decodeCfg(d []byte) (config, int, error) {
+	cfg := config{query: searchQuery{GameVersion: memVersions[0]}, fallbacks: defaultFallbacks()}
+	bs := bitstream.FromBuffer(d)
+	var b int
+	h, err := readHeader(bs, &b, cfgMagic)
+	if err != nil {
+		return cfg, h.version, fmt.Errorf("Corrupt %s file: %w", cfgFile, err)
+	}
+
+	switch h.version {
+	case cfgV0:
+		err = cfg.readV0(bs, &b)
+	case cfgV1:
+		err = readRecord(bs, &b, func(tag int, val *bitstream.Bitstream) error {
+			var err error
+			switch tag {
+			case cfgModLoader:
+				cfg.query.ModLoader, err = readUint(val)
+			case cfgGameVersion:
+				cfg.query.GameVersion, err = readString(val)
+			case cfgVersions:
+				cfg.versions, err = readStrings(val)
+			case cfgAutosave:
+				var autosave int
+				autosave, err = readUint(val)
+				cfg.autosave = autosave != 0
+			case cfgInstance:
+				cfg.instance, err = readString(val)
+			case cfgMetaURL:
+				cfg.metaURL, err = readString(val)
+			case cfgLoaderVersion:
+				cfg.loaderVersion, err = readString(val)
+			case cfgFallbacks:
+				var chain []int
+				chain, err = readUints(val)
+				if len(chain) != 0 {
+					cfg.fallbacks[chain[0]] = chain[1:]
+				}
+			}
+			return err
+		})
+	default:
+		return cfg, h.version, fmt.Errorf("Unknown %s format version %d. This version of mcman supports up to %d", cfgFile, h.version, cfgVersion)
+	}
+
+	if err != nil {
+		return cfg, h.version, fmt.Errorf("Corrupt %s file: %w", cfgFile, err)
+	}
+
+	cfg.versions = append(cfg.versions, memVersions...)
+	return cfg, h.version, nil
+}
+
+func (c *config) readV0(bs *bitstream.Bitstream, bitpos *int) error {
+	if err := readQueryV0(bs, bitpos, &c.query.ModLoader, &c.query.GameVersion); err != nil {
+		return err
+	}
+
+	major := nextMajor
+	versionsLen, err := bs.ReadBits(bitpos, 8)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < versionsLen; i++ {
+		v, err := bs.ReadBits(bitpos, 4)
+		if err != nil {
+			break
+		}
+		c.versions = append([]string{fmt.Sprintf("1.%d", major)}, c.versions...)
+		for minor := 1; minor <= v; minor++ {
+			c.versions = append([]string{fmt.Sprintf("1.%d.%d", major, minor)}, c.versions...)
+		}
+		major++
+	}
+
+	return nil
+}
+
+func readQueryV0(bs *bitstream.Bitstream, b *int, modLoader *int, gameVersion *string) error {
+	var err error
+	*modLoader, err = bs.ReadBits(b, 3)
+	if err != nil {
+		return err
+	}
+
+	major, err := bs.ReadBits(b, 5)
+	if err != nil {
+		return err
+	}
+
+	minor, err := bs.ReadBits(b, 4)
+	if err != nil {
+		return err
+	}
+
+	if minor == 0 {
+		*gameVersion = fmt.Sprintf("1.%d", major)
+	} else {
+		*gameVersion = fmt.Sprintf("1.%d.%d", major, minor)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestChangelogPreviewError(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1/files/12/changelog": "<p>Fixed <b>everything</b></p>",
+	})
+
+	var err error
+	out := captureStdout(t, func() {
+		err = printChangelogs(context.Background(), 1, []CfFile{{ID: 11, Name: "a-1.jar"}, {ID: 12, Name: "a-2.jar"}}, changelogPreviewLines)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(out, "Could not get changelog") || !strings.Contains(out, "everything") {
+		t.Errorf("Expected an error for a-1.jar and the changelog of a-2.jar\nReturned:\n%s", out)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1/files 1.20.1": []CfFile{{ID: 12, Name: "a-beta.jar", Release: Beta}, {ID: 11, Name: "a.jar", Release: Release}},
+		"/v1/mods/2/files 1.20.1": []CfFile{{ID: 21, Name: "b-alpha.jar", Release: Alpha}},
+		"/v1/mods/3/files 1.20.1": []CfFile{},
+	})
+	c := newTestCli(t, "y")
+	c.query = searchQuery{GameVersion: "1.19.4", ModLoader: loaderFabric}
+	for id := 1; id <= 4; id++ {
+		c.mods = append(c.mods, modEntry{Id: id, Name: string(rune('a'+id-1)) + "-old.jar", GameVersion: "1.19.4", ModLoader: loaderFabric})
+	}
+	c.saved = cloneMods(c.mods)
+
+	var records []compatRecord
+	out := captureStdout(t, func() {
+		if err := c.run(t, "check 1.20.1 --json"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+
+	want := []struct {
+		status string
+		file   string
+		err    bool
+	}{
+		{"available", "a.jar", false},
+		{"unstable", "b-alpha.jar", false},
+		{"missing", "", false},
+		{"missing", "", true},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Returned %d records\nExpected: %d", len(records), len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Status != w.status || r.File != w.file || (r.Error != "") != w.err {
+			t.Errorf("Mod %d\nReturned: %+v\nExpected: %+v", i+1, r, w)
+		}
+	}
+
+	out = captureStdout(t, func() {
+		if err := c.run(t, "check 1.20.1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(out, "25%") {
+		t.Errorf("Returned:\n%s\nExpected a readiness of 25%%", out)
+	}
+	if len(c.undoOps) != 0 || c.dirty() {
+		t.Error("check shouldn't change the modlist")
+	}
+}
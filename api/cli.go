@@ -1,25 +1,38 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
-	"time"
+	"sync"
+	"syscall"
 
-	"github.com/stuff7/mcman/bitstream"
+	"github.com/stuff7/mcman/cache"
 	"github.com/stuff7/mcman/readln"
 )
 
 type cli struct {
-	query    searchQuery
+	config
 	Running  bool
 	prompt   string
 	dbg      bool
-	versions []string
+	offline  bool
+	planning bool
+	planLog  strings.Builder
 	mods     []modEntry
+	saved    []modEntry
+	search   searchOptions
+	results  []cfMod
+	page     cfPagination
+	undoOps  []modOp
+	redoOps  []modOp
+	bisect   *bisection
+	cancelMu sync.Mutex
+	cancel   context.CancelFunc
+	busy     sync.Mutex // held while a command runs, except when it waits for input
 }
 
 func NewCli(prompt string) *cli {
@@ -36,8 +49,19 @@ func (c *cli) Run() error {
 		return err
 	}
 
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	go c.handleSignals(sigs)
+
+	if !c.offline {
+		if err := c.runCmd(func(ctx context.Context) error { return c.replayQueue(ctx) }); err != nil {
+			fmt.Printf("%s%s%s\n", clr(220), err, RESET)
+		}
+	}
+
 	for c.Running {
-		_, err := readln.PushLn(c.prompt, &history, func(k readln.Key, s *string, i *int) string {
+		_, err := readln.PushLn(c.promptStr(), &history, func(k readln.Key, s *string, i *int) string {
 			tokens = tokenize(*s)
 			cmd, tokens = c.parseCmd(tokens)
 			return renderTokens(tokens, k, s, i)
@@ -47,10 +71,18 @@ func (c *cli) Run() error {
 			return err
 		}
 
-		if err := cmd.run(); err != nil {
+		if err := c.runCmd(cmd.run); isOffline(err) {
+			fmt.Printf("%s%s. Disable offline mode with %sset offline off%s\n", clr(220), cache.ErrOffline, BOLD, RESET)
+		} else if errors.Is(err, context.Canceled) {
+			fmt.Printf("%sCancelled%s\n", clr(220), RESET)
+		} else if err != nil {
 			fmt.Printf("%s%s%s\n", clr(220), err, RESET)
 		}
 
+		c.busy.Lock()
+		c.autosaveMods()
+		c.busy.Unlock()
+
 		if c.dbg {
 			fmt.Printf("Cmd\n%#+v\n", tokens)
 		}
@@ -60,269 +92,124 @@ func (c *cli) Run() error {
 	return nil
 }
 
-func saveQuery(bs *bitstream.Bitstream, modLoader int, gameVersion string) error {
-	bs.WriteBits(modLoader, 3)
-
-	if len(gameVersion) < 2 {
-		return fmt.Errorf("Invalid game version string %#+v", gameVersion)
-	}
-
-	idx := strings.Index(gameVersion[2:], ".")
-	if idx < 0 {
-		idx = len(gameVersion)
-	} else {
-		idx += 2
-	}
-
-	major, err := strconv.Atoi(gameVersion[2:idx])
-	if err != nil {
-		return err
-	}
-	bs.WriteBits(major, 5)
-
-	minor, err := strconv.Atoi(gameVersion[idx+1:])
-	if err != nil {
-		bs.WriteBits(0, 4)
-	} else {
-		bs.WriteBits(minor, 4)
+// autosaveMods saves the modlist after a command when autosave is on
+func (c *cli) autosaveMods() {
+	if c.autosave && c.Running && c.dirty() {
+		if err := c.saveMods(); err != nil {
+			fmt.Printf("%sAutosave failed: %s%s\n", clr(220), err, RESET)
+		}
 	}
-
-	return nil
 }
 
-func readQuery(bs *bitstream.Bitstream, b *int, modLoader *int, gameVersion *string) error {
-	var err error
-	*modLoader, err = bs.ReadBits(b, 3)
-	if err != nil {
-		return err
-	}
-
-	major, err := bs.ReadBits(b, 5)
-	if err != nil {
-		return err
-	}
-
-	minor, err := bs.ReadBits(b, 4)
-	if err != nil {
+// RunOnce runs the command given by args as if it was typed at the prompt,
+// without the logo or the prompt, and saves the modlist if it changed.
+func (c *cli) RunOnce(args []string) error {
+	if err := c.loadFiles(); err != nil {
 		return err
 	}
 
-	if minor == 0 {
-		*gameVersion = fmt.Sprintf("1.%d", major)
-	} else {
-		*gameVersion = fmt.Sprintf("1.%d.%d", major, minor)
-	}
-
-	return nil
-}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	go c.handleSignals(sigs)
 
-func (c *cli) saveCfg() error {
-	var bs bitstream.Bitstream
+	cmd, _ := c.parseCmd(tokenize(joinArgs(args)))
+	err := c.runCmd(cmd.run)
 
-	if err := saveQuery(&bs, c.query.ModLoader, c.query.GameVersion); err != nil {
+	c.busy.Lock()
+	defer c.busy.Unlock()
+	if err := errors.Join(err, c.stopBisect()); err != nil {
 		return err
 	}
-
-	major := nextMajor
-	minor := 0
-	versionsPos := bs.BitPosition()
-	versionsLen := 0
-	bs.WriteBits(0, 8) // Allocate 8 bits for the length
-	for _, v := range c.versions {
-		idx := strings.LastIndex(v, ".")
-		if idx < 2 {
-			idx = len(v)
-		}
-
-		curr, err := strconv.Atoi(v[2:idx])
-		if err != nil {
-			return err
-		}
-
-		if major != curr {
-			major = curr
-			bs.WriteBits(minor-1, 4)
-			minor = 0
-			versionsLen++
-		} else {
-			minor++
-		}
-
-		if v == memVersions[0] {
-			break
-		}
+	if c.Running && c.dirty() {
+		return c.saveMods()
 	}
-
-	bs.SetBits(versionsLen, versionsPos, 8)
-	bs.SaveToDisk("cfg")
-
 	return nil
 }
 
-func (c *cli) loadFiles() error {
-	c.versions = nil
-	c.query.GameVersion = memVersions[0]
-	if err := c.readMods(); err != nil {
-		return err
-	}
-	versions, err := os.ReadFile("cfg")
-	if err != nil {
-		c.versions = memVersions
-		return nil
-	}
-
-	bs := bitstream.FromBuffer(versions)
-	var bitpos int
+var argQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
 
-	if err := readQuery(bs, &bitpos, &c.query.ModLoader, &c.query.GameVersion); err != nil {
-		return err
-	}
-
-	major := nextMajor
-	versionsLen, err := bs.ReadBits(&bitpos, 8)
-	if err != nil {
-		return err
-	}
-
-	for i := 0; i < versionsLen; i++ {
-		v, err := bs.ReadBits(&bitpos, 4)
-		if err != nil {
-			break
+// joinArgs joins command line arguments into a command, quoting the ones the
+// shell kept together so they stay one word.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n\"\\") {
+			a = `"` + argQuoter.Replace(a) + `"`
 		}
-		c.versions = append([]string{fmt.Sprintf("1.%d", major)}, c.versions...)
-		for minor := 1; minor <= v; minor++ {
-			c.versions = append([]string{fmt.Sprintf("1.%d.%d", major, minor)}, c.versions...)
-		}
-		major++
+		quoted[i] = a
 	}
-
-	c.versions = append(c.versions, memVersions...)
-
-	return nil
+	return strings.Join(quoted, " ")
 }
 
-func (c *cli) readMods() error {
-	if c.mods != nil {
-		return errors.New("Mods already loaded")
-	}
+// runCmd runs fn with a context that is cancelled when SIGINT arrives while it
+// is running.
+func (c *cli) runCmd(fn func(context.Context) error) error {
+	c.busy.Lock()
+	defer c.busy.Unlock()
 
-	d, err := os.ReadFile("modlist")
-	if err != nil {
-		return nil
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	bs := bitstream.FromBuffer(d)
-	b := 0
-	for {
-		var m modEntry
-		m.Id, err = bs.ReadBits(&b, 24)
-		if err != nil {
-			break
-		}
+	c.cancelMu.Lock()
+	c.cancel = cancel
+	c.cancelMu.Unlock()
 
-		if err := readQuery(bs, &b, &m.ModLoader, &m.GameVersion); err != nil {
-			return err
-		}
+	defer func() {
+		c.cancelMu.Lock()
+		c.cancel = nil
+		c.cancelMu.Unlock()
+	}()
 
-		id1, err := bs.ReadBits(&b, 14)
-		if err != nil {
-			return err
-		}
-		id2, err := bs.ReadBits(&b, 10)
-		if err != nil {
-			return err
-		}
+	return fn(ctx)
+}
 
-		depsLen, err := bs.ReadBits(&b, 4)
-		if err != nil {
-			return err
-		}
-		for i := 0; i < depsLen; i++ {
-			dep, err := bs.ReadBits(&b, 24)
-			if err != nil {
-				return err
-			}
-			m.Deps = append(m.Deps, dep)
-		}
+// handleSignals cancels the running command on every signal. SIGTERM and
+// SIGHUP also save and exit, once the command has returned so the modlist it
+// was changing is saved whole.
+func (c *cli) handleSignals(sigs <-chan os.Signal) {
+	for sig := range sigs {
+		c.cancelMu.Lock()
+		cancel := c.cancel
+		c.cancelMu.Unlock()
 
-		m.Name, err = bs.ReadPascalString(&b)
-		if err != nil {
-			return err
+		if cancel != nil {
+			cancel()
 		}
-		m.DownloadUrl = fmt.Sprintf("%s%d/%d/%s", downloadURL, id1, id2, url.QueryEscape(m.Name))
 
-		uploaded, err := bs.ReadBits64(&b, 64)
-		if err != nil {
-			return err
+		if sig == syscall.SIGTERM || sig == syscall.SIGHUP {
+			c.busy.Lock()
+			c.terminate(128 + int(sig.(syscall.Signal)))
 		}
-
-		m.Uploaded = time.Unix(uploaded, 0).UTC()
-		c.mods = append(c.mods, m)
 	}
-
-	return nil
 }
 
-const downloadURL = "https://edge.forgecdn.net/files/"
-
-func (c *cli) saveMods() error {
-	var bs bitstream.Bitstream
-	for _, m := range c.mods {
-		bs.WriteBits(m.Id, 24)
-		if err := saveQuery(&bs, m.ModLoader, m.GameVersion); err != nil {
-			return err
-		}
-
-		r, ok := strings.CutPrefix(m.DownloadUrl, downloadURL)
-		if !ok {
-			fmt.Printf("Download URL mismatch for mod %+v. URL: %+v\n", m.Name, m.DownloadUrl)
-			slashCount := 0
-			idx := strings.LastIndexFunc(m.DownloadUrl, func(r rune) bool {
-				if r == '/' {
-					slashCount++
-				}
-
-				if slashCount == 3 {
-					return true
-				}
-
-				return false
-			})
-
-			if idx == -1 {
-				return fmt.Errorf("Unexpected download URL form for mod %+v. URL: %+v", m.Name, m.DownloadUrl)
-			}
-
-			r = m.DownloadUrl[idx:]
-		}
-		ids := strings.Split(r, "/")
-		if len(ids) < 2 {
-			return fmt.Errorf("Download URL missing id %#+v", ids)
-		}
-		id1, err := strconv.Atoi(ids[0])
-		if err != nil {
-			return err
-		}
-		id2, err := strconv.Atoi(ids[1])
-		if err != nil {
-			return err
-		}
-
-		bs.WriteBits(id1, 14)
-		bs.WriteBits(id2, 10)
-		bs.WriteBits(len(m.Deps), 4)
-		for _, dep := range m.Deps {
-			bs.WriteBits(dep, 24)
-		}
-
-		if err := bs.WritePascalString(m.Name); err != nil {
-			return err
-		}
+func (c *cli) promptStr() string {
+	var b strings.Builder
+	if c.offline {
+		b.WriteString(clr(208) + "[offline] " + RESET)
+	}
+	if c.dirty() {
+		b.WriteString(clr(220) + "*" + RESET)
+	}
+	b.WriteString(c.prompt)
+	return b.String()
+}
 
-		bs.WriteBits64(m.Uploaded.Unix(), 64)
+// terminate saves the modlist and restores the terminal before exiting.
+func (c *cli) terminate(code int) {
+	if err := c.stopBisect(); err != nil {
+		fmt.Printf("%s%s%s\n", clr(220), err, RESET)
+	}
+	if err := c.saveMods(); err != nil {
+		fmt.Printf("%s%s%s\n", clr(220), err, RESET)
+	} else {
+		fmt.Printf("\nSaved %d mods\n", len(c.mods))
 	}
 
-	return bs.SaveToDisk("modlist")
+	readln.Restore()
+	print("\x1b[?25h")
+	os.Exit(code)
 }
 
 const RESET = "\x1b[0m"
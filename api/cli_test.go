@@ -0,0 +1,29 @@
+package api
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestJoinArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"Words", []string{"list", "--json"}, []string{"list", "--json"}},
+		{"Spaces", []string{"search", "sodium extra"}, []string{"search", "sodium extra"}},
+		{"Quotes", []string{"note", "1", `say "hi" \o/`}, []string{"note", "1", `say "hi" \o/`}},
+		{"Empty", []string{"note", "1", ""}, []string{"note", "1", ""}},
+	} {
+		var got []string
+		for _, t := range tokenize(joinArgs(tc.args)) {
+			if t.typ != Space {
+				got = append(got, t.parseString())
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s\nReturned: %#+v\nExpected: %#+v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,19 +14,50 @@ import (
 	"strings"
 	"time"
 
+	"github.com/stuff7/mcman/cache"
+	"github.com/stuff7/mcman/htmlterm"
+	"github.com/stuff7/mcman/readln"
 	"github.com/stuff7/mcman/slc"
 )
 
 type Cmd struct {
 	tokens []token
-	Run    func([]token) error
+	flags  []string
+	Run    func(context.Context, []token) error
 }
 
-func (c *Cmd) run() error {
+func (c *Cmd) run(ctx context.Context) error {
 	if c.Run == nil {
 		return errors.New("Unknown command")
 	}
-	return c.Run(c.tokens)
+
+	var tokens []token
+	var flags []string
+	for i, t := range c.tokens {
+		if t.typ == Space && i > 0 && c.tokens[i-1].typ == Flag {
+			continue
+		}
+		if t.typ != Flag {
+			tokens = append(tokens, t)
+			continue
+		}
+
+		name := strings.TrimPrefix(t.val, "--")
+		if !slices.Contains(c.flags, name) {
+			return fmt.Errorf("Unknown flag %s", t.val)
+		}
+		flags = append(flags, name)
+	}
+
+	return c.Run(context.WithValue(ctx, flagsKey{}, flags), tokens)
+}
+
+type flagsKey struct{}
+
+// hasFlag reports whether the running command was given --name.
+func hasFlag(ctx context.Context, name string) bool {
+	flags, _ := ctx.Value(flagsKey{}).([]string)
+	return slices.Contains(flags, name)
 }
 
 type commandType int
@@ -44,14 +77,36 @@ const (
 	CmdAdd
 	CmdRem
 	CmdImport
+	CmdUpdate
+	CmdChangelog
+	CmdCheck
+	CmdMigrate
+	CmdUndo
+	CmdRedo
 	CmdExport
 	CmdClear
 	CmdDownload
+	CmdWorlds
+	CmdTag
+	CmdUntag
+	CmdNote
+	CmdDisable
+	CmdEnable
+	CmdBisect
+	CmdLoader
 	CmdList
 	CmdSearch
+	CmdInfo
+	CmdFiles
+	CmdNext
+	CmdPrev
 	CmdHelp
 	CmdDebug
 	CmdVersion
+	CmdCache
+	CmdRestore
+	CmdPlan
+	CmdSave
 	CmdQuit
 )
 
@@ -60,14 +115,36 @@ var commands = []command{
 	newCommand(CmdAdd, "Add a new mod", "add"),
 	newCommand(CmdRem, "Remove a mod", "remove", "rm", "rem", "del"),
 	newCommand(CmdImport, "Import mods from json file { id: string }[]", "import"),
+	newCommand(CmdUpdate, "Update mods to their latest file or check for updates", "update", "up"),
+	newCommand(CmdChangelog, "Show what changed in the files between the installed one and the latest", "changelog"),
+	newCommand(CmdCheck, "Check which mods are available for another game version or loader", "check"),
+	newCommand(CmdMigrate, "Move every mod to another game version or loader", "migrate"),
+	newCommand(CmdPlan, "Preview the changes of add, rem, import, update or migrate before applying them", "plan"),
+	newCommand(CmdUndo, "Undo the last change to the modlist", "undo"),
+	newCommand(CmdRedo, "Redo the last undone change", "redo"),
 	newCommand(CmdExport, "Export mods to json file", "export"),
 	newCommand(CmdClear, "Clear the terminal", "clear"),
-	newCommand(CmdDownload, "Download all mods", "download", "dwn"),
-	newCommand(CmdList, "List all the mods", "list", "ls"),
+	newCommand(CmdDownload, "Download all mods into the instance directory", "download", "dwn"),
+	newCommand(CmdWorlds, "List worlds and their datapacks or tie a datapack to worlds", "worlds"),
+	newCommand(CmdTag, "Tag a mod or show its tags", "tag"),
+	newCommand(CmdUntag, "Remove tags from a mod, or all of them", "untag"),
+	newCommand(CmdNote, "Set, clear or show the note of a mod", "note"),
+	newCommand(CmdDisable, "Disable mods, keeping them in the list with their files renamed to .disabled", "disable"),
+	newCommand(CmdEnable, "Enable disabled mods", "enable"),
+	newCommand(CmdBisect, "Find the mod causing a problem by disabling half of the suspects at a time", "bisect"),
+	newCommand(CmdLoader, "Show, list or install Fabric and Quilt loader versions", "loader"),
+	newCommand(CmdList, "List the mods, filtered with where, top-level or deps-only and ordered with sort", "list", "ls"),
 	newCommand(CmdSet, "Set global query parameters", "set", "global"),
-	newCommand(CmdSearch, "Search mods", "search", "find", "fn"),
+	newCommand(CmdSearch, "Search mods, or only the modlist entries with a tag when given tag <tag>", "search", "find", "fn"),
+	newCommand(CmdInfo, "Show details of a mod", "info"),
+	newCommand(CmdFiles, "List the files of a mod for the current query", "files"),
+	newCommand(CmdNext, "Show the next page of the last search", "next"),
+	newCommand(CmdPrev, "Show the previous page of the last search", "prev"),
 	newCommand(CmdDebug, "Enable/Disable debug logs", "debug", "dbg"),
 	newCommand(CmdVersion, "Update saved versions", "versions"),
+	newCommand(CmdCache, "Show stats, clear or configure the HTTP cache", "cache"),
+	newCommand(CmdRestore, "List backups or restore the modlist or cfg from one", "restore"),
+	newCommand(CmdSave, "Save the modlist", "save", "w"),
 	newCommand(CmdQuit, "Quit", "quit", "qa", "q", "exit"),
 }
 var cmdNames = slc.Flatten(slc.Map(commands, func(c command) []string { return c.aliases }))
@@ -80,8 +157,12 @@ func (c *cli) parseCmd(tokens []token) (Cmd, []token) {
 		return cmd, tokens
 	}
 
-	if ok := nextNonSpaceToken(tokens, &i); ok != nil {
-		cmd.tokens = tokens[i-1:]
+	j := i
+	for j < len(tokens) && tokens[j].typ == Space {
+		j++
+	}
+	if j < len(tokens) {
+		cmd.tokens = tokens[j:]
 	}
 
 	var parseKeywords func([]token) []token
@@ -91,23 +172,92 @@ func (c *cli) parseCmd(tokens []token) (Cmd, []token) {
 
 			switch cmdN.typ {
 			case CmdSearch:
+				parseKeywords = c.searchCmdKwords
+				cmd.flags = outputFlags
 				cmd.Run = c.searchCmd
+			case CmdNext:
+				cmd.flags = outputFlags
+				cmd.Run = c.nextCmd
+			case CmdPrev:
+				cmd.flags = outputFlags
+				cmd.Run = c.prevCmd
 			case CmdAdd:
-				parseKeywords = addCmdKwords
-				cmd.Run = c.addCmd
+				parseKeywords = c.resultCmdKwords([]string{"search", "id"})
+				cmd.flags = planFlags
+				cmd.Run = c.mutating(t.val, c.addCmd)
+			case CmdInfo:
+				parseKeywords = c.resultCmdKwords([]string{"id"})
+				cmd.flags = outputFlags
+				cmd.Run = c.infoCmd
+			case CmdFiles:
+				parseKeywords = c.resultCmdKwords([]string{"id"})
+				cmd.flags = outputFlags
+				cmd.Run = c.filesCmd
 			case CmdRem:
 				parseKeywords = remCmdKwords
-				cmd.Run = c.remCmd
+				cmd.flags = planFlags
+				cmd.Run = c.mutating(t.val, c.remCmd)
 			case CmdImport:
-				cmd.Run = c.importCmd
+				cmd.flags = planFlags
+				cmd.Run = c.mutating(t.val, c.importCmd)
+			case CmdUpdate:
+				parseKeywords = updateCmdKwords
+				cmd.flags = planFlags
+				cmd.Run = c.mutating(t.val, c.updateCmd)
+			case CmdChangelog:
+				cmd.Run = c.changelogCmd
+			case CmdCheck:
+				parseKeywords = c.targetCmdKwords
+				cmd.flags = outputFlags
+				cmd.Run = c.checkCmd
+			case CmdMigrate:
+				parseKeywords = c.targetCmdKwords
+				cmd.flags = planFlags
+				cmd.Run = c.mutating(t.val, c.migrateCmd)
+			case CmdPlan:
+				var sub Cmd
+				cmd.flags = planFlags
+				parseKeywords = func(tokens []token) []token {
+					sub, tokens = c.parseCmd(tokens)
+					return tokens
+				}
+				cmd.Run = func(ctx context.Context, _ []token) error { return c.planCmd(ctx, sub) }
+			case CmdUndo:
+				cmd.Run = c.undoCmd
+			case CmdRedo:
+				cmd.Run = c.redoCmd
 			case CmdExport:
+				parseKeywords = sideCmdKwords
 				cmd.Run = c.exportCmd
 			case CmdClear:
 				cmd.Run = c.clearCmd
 			case CmdDownload:
-				cmd.Run = c.downloadCmd
+				parseKeywords = sideCmdKwords
+				cmd.Run = c.mutating(t.val, c.downloadCmd)
+			case CmdWorlds:
+				parseKeywords = worldsCmdKwords
+				cmd.Run = c.mutating(t.val, c.worldsCmd)
+			case CmdTag:
+				parseKeywords = c.tagCmdKwords
+				cmd.Run = c.mutating(t.val, c.tagCmd)
+			case CmdUntag:
+				parseKeywords = c.tagCmdKwords
+				cmd.Run = c.mutating(t.val, c.untagCmd)
+			case CmdNote:
+				cmd.Run = c.mutating(t.val, c.noteCmd)
+			case CmdDisable:
+				cmd.Run = c.mutating(t.val, c.disableCmd)
+			case CmdEnable:
+				cmd.Run = c.mutating(t.val, c.enableCmd)
+			case CmdBisect:
+				parseKeywords = bisectCmdKwords
+				cmd.Run = c.bisectCmd
+			case CmdLoader:
+				parseKeywords = loaderCmdKwords
+				cmd.Run = c.loaderCmd
 			case CmdList:
-				parseKeywords = addCmdKwords
+				parseKeywords = listCmdKwords
+				cmd.flags = outputFlags
 				cmd.Run = c.listCmd
 			case CmdSet:
 				parseKeywords = c.queryCmdKwords
@@ -119,14 +269,25 @@ func (c *cli) parseCmd(tokens []token) (Cmd, []token) {
 			case CmdVersion:
 				parseKeywords = versionCmdKwords
 				cmd.Run = c.versionCmd
+			case CmdCache:
+				parseKeywords = cacheCmdKwords
+				cmd.Run = c.cacheCmd
+			case CmdRestore:
+				parseKeywords = restoreCmdKwords
+				cmd.Run = c.restoreCmd
+			case CmdSave:
+				cmd.Run = c.saveCmd
 			case CmdQuit:
 				cmd.Run = c.quitCmd
 			}
 
 			if parseKeywords != nil && len(cmd.tokens) != 0 {
 				cmd.tokens = parseKeywords(cmd.tokens)
-				tokens = slices.Concat(tokens[:i-1], cmd.tokens)
 			}
+			if cmdN.typ != CmdPlan {
+				completeFlags(cmd.tokens, cmd.flags)
+			}
+			tokens = slices.Concat(tokens[:j], cmd.tokens)
 		}
 	}
 
@@ -158,24 +319,25 @@ func findClosest(in string, aliases []string) *string {
 	return nil
 }
 
-func (c *cli) clearCmd([]token) error {
+func (c *cli) clearCmd(context.Context, []token) error {
 	fmt.Printf("\x1b[2J\x1b[1;1H%s", LOGO)
 	return nil
 }
 
-func (c *cli) exportCmd(tokens []token) error {
-	var out string
-	if len(tokens) == 0 {
-		out = "mods.json"
-	} else {
-		var i int
-		t := nextNonSpaceToken(tokens, &i)
-		if t != nil && t.typ == String {
-			out = t.parseString()
-		}
+func (c *cli) exportCmd(ctx context.Context, tokens []token) error {
+	out := "mods.json"
+	var i int
+	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == String {
+		out = t.parseString()
+	}
+
+	target, err := sideArg(tokens)
+	if err != nil {
+		return err
 	}
 
-	data, err := json.Marshal(c.mods)
+	mods := slc.Filter(c.mods, func(m modEntry) bool { return m.Side.runsOn(target) })
+	data, err := json.Marshal(mods)
 	if err != nil {
 		return err
 	}
@@ -184,12 +346,12 @@ func (c *cli) exportCmd(tokens []token) error {
 		return err
 	}
 
-	fmt.Printf("Exported %d mods to %+v\n", len(c.mods), out)
+	fmt.Printf("Exported %d mods to %+v\n", len(mods), out)
 
 	return nil
 }
 
-func (c *cli) importCmd(tokens []token) error {
+func (c *cli) importCmd(ctx context.Context, tokens []token) error {
 	if len(tokens) == 0 {
 		return errors.New("Usage: import <file.json>")
 	}
@@ -204,52 +366,39 @@ func (c *cli) importCmd(tokens []token) error {
 		return errors.New("Invalid argument. Expected a string")
 	}
 
-	if err := c.importMods(t.parseString()); err != nil {
+	if err := c.importMods(ctx, t.parseString()); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *cli) listCmd(tokens []token) error {
-	if len(tokens) == 0 {
-		listMods(c.mods, nil)
-		return nil
+func (c *cli) listCmd(ctx context.Context, tokens []token) error {
+	format, err := outputOf(ctx)
+	if err != nil {
+		return err
 	}
 
-	var i int
-	t := nextNonSpaceToken(tokens, &i)
-	v := nextNonSpaceToken(tokens, &i)
+	filter, err := c.parseModFilter(tokens)
+	if err != nil {
+		return err
+	}
 
-	if t == nil || v == nil || t.typ != Keyword {
-		return errors.New("Missing argument")
+	idxs := filter.apply(c.mods)
+	if format != outputText {
+		return writeOutput(format, modRecords(c.mods, idxs))
 	}
 
-	var search string
-	switch t.val {
-	case "search":
-		if v.typ != String {
-			return errors.New("Invalid argument type")
-		}
-		search = v.parseString()
-		listMods(c.mods, func(m modEntry) bool {
-			return strings.Contains(m.Name, search) || slc.FuzzyStringCompare(m.Name, search) < 0.8
-		})
-	case "id":
-		if v.typ != Number {
-			return errors.New("Invalid argument type")
-		}
-		search = strconv.Itoa(v.parseNumber())
-		listMods(c.mods, func(m modEntry) bool {
-			return strings.Contains(strconv.Itoa(m.Id), search)
-		})
+	if len(idxs) == 0 && len(c.mods) != 0 {
+		fmt.Printf("No mods found that matched %s\n", strings.TrimSpace(joinTokens(tokens)))
+		return nil
 	}
 
-	fmt.Printf("No mods found that matched %+v: %+v", t.val, search)
+	listMods(c.mods, idxs)
 	return nil
 }
 
-func (c *cli) remCmd(tokens []token) error {
+func (c *cli) remCmd(ctx context.Context, tokens []token) error {
 	if len(tokens) == 0 {
 		return errors.New("Usage: rem <option> [optionValue]\noptions:\n\tsearch <string>\n\tid <number>\n\tindex <number>")
 	}
@@ -291,28 +440,67 @@ func (c *cli) remCmd(tokens []token) error {
 	return nil
 }
 
-func (c *cli) downloadCmd(tokens []token) error {
-	if len(tokens) == 0 {
-		return errors.New("Usage: download [directory]")
-	}
+// downloadCmd downloads every entry into the directory of its class under
+// the instance root, which defaults to the configured instance. It runs as a
+// change to the modlist since it saves the sides it finds in the jars.
+func (c *cli) downloadCmd(ctx context.Context, tokens []token) error {
+	root := c.instanceDir()
 	var i int
-	var dir string
 	t := nextNonSpaceToken(tokens, &i)
 	if t != nil && t.typ == String {
-		dir = t.parseString()
+		root = t.parseString()
+	}
+
+	target, err := sideArg(tokens)
+	if err != nil {
+		return err
+	}
+
+	if c.offline {
+		line := "download " + strconv.Quote(root)
+		if target != sideBoth {
+			line += " side " + target.String()
+		}
+		return c.enqueue(line)
 	}
 
 	var txt string
-	for i, m := range c.mods {
-		downloaded, err := downloadFile(m.DownloadUrl, filepath.Join(dir, url.QueryEscape(m.Name)))
-		if err != nil {
-			txt = fmt.Sprintf("%sdownload failed\t%s", clr(218), err)
-			time.Sleep(time.Second)
-		} else if downloaded {
-			txt = clr(48) + "downloaded"
-			time.Sleep(time.Second)
-		} else {
-			txt = clr(45) + "already exists"
+	for i := range c.mods {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		m := &c.mods[i]
+		switch {
+		case m.Stranded:
+			txt = clr(219) + "stranded, skipped"
+		case !m.Side.runsOn(target):
+			txt = fmt.Sprintf("%s%s only, skipped", clr(248), m.Side)
+		default:
+			var status []string
+			for j, path := range installPaths(root, *m) {
+				if m.Disabled {
+					if err := setDisabled(path, true); err != nil {
+						status = append(status, fmt.Sprintf("%sdisable failed\t%s", clr(218), err))
+						continue
+					}
+					path += disabledExt
+				}
+				if classOf(m.Class).id != classDatapack || len(m.Worlds) == 0 {
+					status = append(status, downloadMod(ctx, m, path, target))
+					continue
+				}
+
+				txt = clr(219) + "no such world"
+				if _, err := os.Stat(filepath.Dir(filepath.Dir(path))); err == nil {
+					txt = downloadMod(ctx, m, path, target)
+				}
+				status = append(status, fmt.Sprintf("%s%s:%s %s", RESET, m.Worlds[j], RESET, txt))
+			}
+			txt = strings.Join(status, RESET+", ")
+			if m.Disabled {
+				txt += fmt.Sprintf("%s, %sdisabled", RESET, clr(248))
+			}
 		}
 		fmt.Printf("[%s%03d%s / %s%03d%s] %s%#+v %s\t%s\n", clr(156), i+1, RESET, clr(156), len(c.mods), RESET, BOLD, m.Name, txt, RESET)
 	}
@@ -320,192 +508,1347 @@ func (c *cli) downloadCmd(tokens []token) error {
 	return nil
 }
 
-func (c *cli) addCmd(tokens []token) error {
-	if len(tokens) == 0 {
-		return errors.New("Usage: add <option> [optionValue]\noptions:\n\tsearch <string>\n\tid <number>")
+func (c *cli) worldsCmd(ctx context.Context, tokens []token) error {
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil {
+		return c.listWorlds()
 	}
 
-	var prevT *token
-	var i int
-	for {
-		t := nextNonSpaceToken(tokens, &i)
-		if t == nil {
-			break
-		}
+	usage := errors.New("Usage: worlds [set <id> \"world\"...]")
+	if t.typ != Keyword || t.val != "set" {
+		return usage
+	}
 
-		if prevT != nil && prevT.typ == Keyword {
-			switch prevT.val {
-			case "search":
-				if t.typ != String {
-					return errors.New("Invalid search value. Expected a string")
-				}
+	id := nextNonSpaceToken(tokens, &i)
+	if id == nil || id.typ != Number {
+		return usage
+	}
 
-				if err := c.addMod(t.parseString(), false); err != nil {
-					return err
-				}
-				continue
-			case "id":
-				if t.typ != Number {
-					return errors.New("Invalid mod id value. Expected a number")
-				}
+	idx := slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == id.parseNumber() })
+	if idx == -1 {
+		return fmt.Errorf("Could not find mod with id %d", id.parseNumber())
+	}
 
-				if err := c.addMod(t.parseNumber(), false); err != nil {
-					return err
-				}
-				continue
-			}
-		}
+	m := &c.mods[idx]
+	if classOf(m.Class).id != classDatapack {
+		return fmt.Errorf("%s is a %s, only datapacks can be tied to worlds", m.Name, classOf(m.Class).name)
+	}
 
-		prevT = t
+	var worlds []string
+	for t = nextNonSpaceToken(tokens, &i); t != nil; t = nextNonSpaceToken(tokens, &i) {
+		if t.typ == Unknown && t.val == "" {
+			continue
+		}
+		if name := t.parseString(); t.typ == String && validDirName(name) {
+			worlds = append(worlds, name)
+			continue
+		}
+		return fmt.Errorf("Invalid world name %s", t.val)
 	}
 
+	m.Worlds = worlds
+	if len(worlds) == 0 {
+		fmt.Printf("%s%s%s is no longer tied to any world\n", BOLD, m.Name, RESET)
+	} else {
+		fmt.Printf("%s%s%s goes into %s\n", BOLD, m.Name, RESET, strings.Join(worlds, ", "))
+	}
 	return nil
 }
 
-func (c *cli) versionCmd(tokens []token) error {
-	if len(tokens) == 0 {
-		fmt.Printf(
-			"Found %s%d%s versions locally (Run %sversion update%s to update)\n%s\n",
-			clr(157),
-			len(c.versions),
-			RESET,
-			BOLD,
-			RESET,
-			strings.Join(c.versions, " | "),
-		)
-		return nil
+// modArg finds the mod whose id is the first word of tokens and returns the
+// words after it.
+func (c *cli) modArg(tokens []token, usage string) (*modEntry, [][]token, error) {
+	ws := words(tokens)
+	if len(ws) == 0 || len(ws[0]) != 1 || ws[0][0].typ != Number {
+		return nil, nil, errors.New(usage)
 	}
 
-	if tokens[0].typ == Keyword {
-		versions, err := getVersions()
-		if err != nil {
-			return err
-		}
+	id := ws[0][0].parseNumber()
+	idx := slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == id })
+	if idx == -1 {
+		return nil, nil, fmt.Errorf("Could not find mod with id %d", id)
+	}
 
-		if len(versions) == len(c.versions) {
-			fmt.Printf("%sUp to date%s\n", clr(46), RESET)
-			return nil
-		}
+	return &c.mods[idx], ws[1:], nil
+}
 
-		var newVersions []string
-		for _, v := range versions {
-			if v.Version == memVersions[0] {
-				break
-			}
+func printTags(m *modEntry) {
+	if len(m.Tags) == 0 {
+		fmt.Printf("%s%s%s has no tags\n", BOLD, m.Name, RESET)
+		return
+	}
+	fmt.Printf("%s%s%s is tagged %s%s%s\n", BOLD, m.Name, RESET, clr(117), strings.Join(m.Tags, ", "), RESET)
+}
 
-			newVersions = append(newVersions, v.Version)
+func (c *cli) tagCmd(ctx context.Context, tokens []token) error {
+	m, ws, err := c.modArg(tokens, "Usage: tag <id> [tag...]")
+	if err != nil {
+		return err
+	}
+
+	for _, w := range ws {
+		tag := wordString(w)
+		if strings.TrimSpace(tag) == "" || strings.ContainsAny(tag, ",;") {
+			return fmt.Errorf("Invalid tag %q. Tags can't be blank or have , or ; in them", tag)
+		}
+		if !m.hasTag(tag) {
+			m.Tags = append(m.Tags, tag)
 		}
+	}
 
-		c.versions = append(newVersions, c.versions...)
-		if err := c.saveCfg(); err != nil {
-			return err
+	printTags(m)
+	return nil
+}
+
+func (c *cli) untagCmd(ctx context.Context, tokens []token) error {
+	m, ws, err := c.modArg(tokens, "Usage: untag <id> [tag...]")
+	if err != nil {
+		return err
+	}
+
+	if len(ws) == 0 {
+		m.Tags = nil
+	}
+	for _, w := range ws {
+		tag := wordString(w)
+		if !m.hasTag(tag) {
+			return fmt.Errorf("%s is not tagged %s", m.Name, tag)
 		}
+		m.Tags = slices.DeleteFunc(m.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+	}
+	if len(m.Tags) == 0 {
+		m.Tags = nil
 	}
 
+	printTags(m)
 	return nil
 }
 
-var helpTable string
+func (c *cli) noteCmd(ctx context.Context, tokens []token) error {
+	usage := "Usage: note <id> [\"note\"]"
+	m, ws, err := c.modArg(tokens, usage)
+	if err != nil {
+		return err
+	}
 
-func (c *cli) helpCmd(tokens []token) error {
-	if len(helpTable) != 0 {
-		println(helpTable)
-		return nil
+	switch {
+	case len(ws) == 0:
+		if m.Note == "" {
+			fmt.Printf("%s%s%s has no note\n", BOLD, m.Name, RESET)
+			return nil
+		}
+	case len(ws) == 1 && len(ws[0]) == 1 && ws[0][0].typ == String:
+		m.Note = strings.TrimSpace(ws[0][0].parseString())
+		if m.Note == "" {
+			fmt.Printf("Cleared the note of %s%s%s\n", BOLD, m.Name, RESET)
+			return nil
+		}
+	default:
+		return errors.New(usage)
 	}
 
-	rows := make([][3]string, len(commands)+2)
-	rows[0] = [3]string{"Command", "Description", " "}
-	rows[1][2] = "-"
-	maxLn := []int{len(rows[0][0]), len(rows[0][1])}
-	for j, cmd := range commands {
-		rows[j+2] = [3]string{cmd.aliases[0], cmd.description, " "}
-		for i, n := range rows[j+2][:2] {
-			l := &maxLn[i]
-			if n := len(n); n > *l {
-				*l = n
+	fmt.Printf("%s%s%s: %s\n", BOLD, m.Name, RESET, m.Note)
+	return nil
+}
+
+// listWorlds prints the worlds of the instance with their datapacks, marking
+// the ones the modlist ties to each world and the ones still missing.
+func (c *cli) listWorlds() error {
+	worlds, err := readWorlds(c.instanceDir())
+	if err != nil {
+		return err
+	}
+
+	for _, m := range c.mods {
+		for _, w := range m.Worlds {
+			if !slices.ContainsFunc(worlds, func(wo world) bool { return wo.name == w }) {
+				worlds = append(worlds, world{name: w})
 			}
 		}
 	}
 
-	var sb strings.Builder
-	for _, row := range rows {
-		for i, s := range row[:2] {
-			l := &maxLn[i]
-			sb.WriteString(fmt.Sprintf("|%s%s%s", row[2], s, strings.Repeat(row[2], *l-len(s)+1)))
+	if len(worlds) == 0 {
+		fmt.Printf("No worlds in %s\n", filepath.Join(c.instanceDir(), "saves"))
+		return nil
+	}
+
+	for _, w := range worlds {
+		fmt.Printf("%s%s%s\n", clr(214)+BOLD, w.name, RESET)
+		tied := slc.Filter(c.mods, func(m modEntry) bool { return slices.Contains(m.Worlds, w.name) })
+		for _, p := range w.datapacks {
+			if slices.ContainsFunc(tied, func(m modEntry) bool { return url.QueryEscape(m.Name) == p }) {
+				fmt.Printf("  %s+ %s%s\n", clr(49), p, RESET)
+			} else {
+				fmt.Printf("  %s? %s (not in modlist)%s\n", clr(248), p, RESET)
+			}
+		}
+		for _, m := range tied {
+			if !slices.Contains(w.datapacks, url.QueryEscape(m.Name)) {
+				fmt.Printf("  %s- %s (not downloaded)%s\n", clr(219), m.Name, RESET)
+			}
 		}
-		sb.WriteString("|\n")
 	}
 
-	helpTable = sb.String()
-	return c.helpCmd(tokens)
+	return nil
 }
 
-func (c *cli) quitCmd(tokens []token) error {
-	c.Running = false
+func (c *cli) loaderCmd(ctx context.Context, tokens []token) error {
 	var i int
-	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == Symbol && t.val == "!" {
-		fmt.Println("Quit without saving")
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil {
+		if c.loaderVersion == "" {
+			fmt.Printf("No loader installed. Run %sloader install [version]%s to install one\n", BOLD, RESET)
+		} else {
+			fmt.Printf("%s %s%s%s for %s\n", modLoaderKeywords[c.query.ModLoader], BOLD, c.loaderVersion, RESET, c.query.GameVersion)
+		}
 		return nil
 	}
 
-	fmt.Printf("Saved %d mods", len(c.mods))
-	return c.saveMods()
-}
+	if t.typ != Keyword {
+		return errors.New("Usage: loader [versions|install [version]]")
+	}
 
-func (c *cli) searchCmd(tokens []token) error {
-	var search string
-	if len(tokens) != 0 && tokens[0].typ == String {
-		search = tokens[0].parseString()
-	} else {
-		search = joinTokens(tokens)
+	if c.offline {
+		if t.val == "versions" {
+			return cache.ErrOffline
+		}
+		return c.enqueue(strings.TrimSpace("loader " + joinTokens(tokens)))
 	}
 
-	mods, err := searchMods(search, c.query)
+	versions, err := c.loaderVersions(ctx)
 	if err != nil {
 		return err
 	}
-	for _, mod := range mods {
-		fmt.Printf("[%sID: %s%d%s] %s\n%sDownloads: %s%d\n%s%s\n\n", clr(218), clr(194), mod.ID, RESET, mod.Name, clr(218), clr(194), mod.DownloadCount, RESET, mod.Summary)
+	if len(versions) == 0 {
+		return fmt.Errorf("No %s versions for %s", modLoaderKeywords[c.query.ModLoader], c.query.GameVersion)
 	}
-	return nil
-}
 
-func (c *cli) setQueryCmd(tokens []token) error {
-	if len(tokens) == 0 {
-		fmt.Println(c.query)
+	if t.val == "versions" {
+		for _, v := range versions {
+			if v.stable() {
+				fmt.Printf("%s%s%s\n", clr(49), v.Loader.Version, RESET)
+			} else {
+				fmt.Printf("%s%s (unstable)%s\n", clr(248), v.Loader.Version, RESET)
+			}
+		}
 		return nil
 	}
 
-	for i := 0; i < len(tokens); i++ {
-		k := nextNonSpaceToken(tokens, &i)
-		if k.typ == Ident {
-			v := nextNonSpaceToken(tokens, &i)
-			if v == nil {
-				return errors.New("Missing value")
-			}
+	var version string
+	if v := nextNonSpaceToken(tokens, &i); v != nil && v.val != "" {
+		version = strings.TrimSpace(joinTokens(tokens[i-1:]))
+	} else if idx := slices.IndexFunc(versions, loaderVersion.stable); idx != -1 {
+		version = versions[idx].Loader.Version
+	} else {
+		version = versions[0].Loader.Version
+	}
 
-			switch k.val {
-			case "gameVersion":
-				if v.typ != Keyword {
-					return fmt.Errorf("Invalid value %+v", v)
-				}
-				c.query.GameVersion = v.val
-			case "modLoader":
-				if v.typ != Keyword {
-					return errors.New("Invalid value")
-				}
-				c.query.ModLoader = slices.Index(modLoaderKeywords, v.val)
-			}
-		} else {
-			return fmt.Errorf("Unknown query key %s", k.val)
-		}
+	if !slices.ContainsFunc(versions, func(v loaderVersion) bool { return v.Loader.Version == version }) {
+		return fmt.Errorf("%s %s is not available for %s. Run %sloader versions%s to list them", modLoaderKeywords[c.query.ModLoader], version, c.query.GameVersion, BOLD, RESET)
+	}
+
+	id, err := c.installLoader(ctx, version)
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("Query Updated:", c.query)
+	c.loaderVersion = version
+	fmt.Printf("Installed %s%s%s into %s\n", BOLD, id, RESET, filepath.Join(c.instanceDir(), "versions", id))
 	return c.saveCfg()
 }
 
-func (c *cli) debugCmd([]token) error {
+// downloadMod downloads the jar of m into name and reads its side from the jar
+// when the provider didn't list one. A jar that turns out not to belong to
+// target is removed again.
+func downloadMod(ctx context.Context, m *modEntry, name string, target side) string {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return fmt.Sprintf("%sdownload failed\t%s", clr(218), err)
+	}
+
+	downloaded, err := downloadFile(ctx, m.DownloadUrl, name)
+	if err != nil {
+		return fmt.Sprintf("%sdownload failed\t%s", clr(218), err)
+	}
+
+	txt := clr(45) + "already exists"
+	if downloaded {
+		txt = clr(48) + "downloaded"
+	}
+
+	if classOf(m.Class).id == classWorld && downloaded {
+		if err := extractZip(name, filepath.Dir(name)); err != nil {
+			return fmt.Sprintf("%sextract failed\t%s", clr(218), err)
+		}
+		txt = clr(48) + "downloaded and extracted"
+	}
+
+	if m.Side != sideUnknown {
+		return txt
+	}
+
+	if s, err := jarSide(name); err == nil && s != sideUnknown {
+		m.Side = s
+		if !s.runsOn(target) {
+			os.Remove(name)
+			return fmt.Sprintf("%s%s only, removed", clr(248), s)
+		}
+	}
+
+	return txt
+}
+
+// sideArg reads an optional side <client|server|both> argument. Without one
+// mods of every side are included.
+func sideArg(tokens []token) (side, error) {
+	var i int
+	for {
+		t := nextNonSpaceToken(tokens, &i)
+		if t == nil {
+			return sideBoth, nil
+		}
+		if t.typ != Keyword || t.val != "side" {
+			continue
+		}
+
+		v := nextNonSpaceToken(tokens, &i)
+		if v == nil || v.typ != Keyword {
+			return sideBoth, errors.New("Invalid side. Expected client, server or both")
+		}
+		return side(slices.Index(sideKeywords, v.val)), nil
+	}
+}
+
+func (c *cli) addCmd(ctx context.Context, tokens []token) error {
+	if len(tokens) == 0 {
+		return errors.New("Usage: add <resultIndex...> | add <option> [optionValue]\noptions:\n\tsearch <string>\n\tid <number>")
+	}
+
+	var prevT *token
+	var i int
+	for {
+		t := nextNonSpaceToken(tokens, &i)
+		if t == nil {
+			break
+		}
+
+		if prevT != nil && prevT.typ == Keyword {
+			switch prevT.val {
+			case "search":
+				if t.typ != String {
+					return errors.New("Invalid search value. Expected a string")
+				}
+
+				if err := c.addMod(ctx, t.parseString(), false); err != nil {
+					return err
+				}
+				continue
+			case "id":
+				if t.typ != Number {
+					return errors.New("Invalid mod id value. Expected a number")
+				}
+
+				if err := c.addMod(ctx, t.parseNumber(), false); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if t.typ == Number {
+			m, err := c.resultAt(t)
+			if err != nil {
+				return err
+			}
+
+			if err := c.addMod(ctx, m.ID, false); err != nil {
+				return err
+			}
+		}
+
+		prevT = t
+	}
+
+	return nil
+}
+
+func (c *cli) infoCmd(ctx context.Context, tokens []token) error {
+	if len(tokens) == 0 {
+		return errors.New("Usage: info <resultIndex...> | info id <number>")
+	}
+
+	format, err := outputOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids, err := c.resultIds(tokens)
+	if err != nil {
+		return err
+	}
+
+	var records []infoRecord
+	for _, id := range ids {
+		mod, err := getMod(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		description, err := getDescription(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if format != outputText {
+			records = append(records, c.infoRecord(mod, description))
+			continue
+		}
+		c.printModInfo(mod, htmlterm.Render(description, readln.Width()))
+	}
+
+	if format != outputText {
+		return writeOutput(format, records)
+	}
+	return nil
+}
+
+// resultIds reads the mod ids of search result indices and of numbers after
+// the id keyword.
+func (c *cli) resultIds(tokens []token) ([]int, error) {
+	var ids []int
+	var prevT *token
+	var i int
+	for {
+		t := nextNonSpaceToken(tokens, &i)
+		if t == nil {
+			break
+		}
+
+		if t.typ != Number {
+			prevT = t
+			continue
+		}
+
+		if prevT != nil && prevT.typ == Keyword && prevT.val == "id" {
+			ids = append(ids, t.parseNumber())
+			continue
+		}
+
+		m, err := c.resultAt(t)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, m.ID)
+	}
+
+	return ids, nil
+}
+
+func (c *cli) filesCmd(ctx context.Context, tokens []token) error {
+	if len(tokens) == 0 {
+		return errors.New("Usage: files <resultIndex...> | files id <number>")
+	}
+
+	format, err := outputOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids, err := c.resultIds(tokens)
+	if err != nil {
+		return err
+	}
+
+	var records []fileRecord
+	for _, id := range ids {
+		mod, err := getMod(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		query := modEntry{Class: mod.Class}.target(c.query)
+		files, err := c.getModFilesFallback(ctx, id, query)
+		if err != nil {
+			return err
+		}
+		slices.SortFunc(files.Files, func(a, b CfFile) int { return b.Uploaded.Compare(a.Uploaded) })
+
+		if format != outputText {
+			for _, f := range files.Files {
+				records = append(records, newFileRecord(id, files.ModLoader, f))
+			}
+			continue
+		}
+
+		fmt.Printf(
+			"%s%s%s # %s%d%s: %s%d%s files for %s %s%s\n",
+			clr(214)+BOLD, mod.Name, RESET, clr(157), mod.ID, RESET, clr(157), len(files.Files), RESET,
+			query.GameVersion, modLoaderKeywords[query.ModLoader], viaFallback(query, files.ModLoader),
+		)
+		for _, f := range files.Files {
+			fmt.Printf(
+				"  %s%s%s # %s%d%s %s(%s)%s %s [%s]\n",
+				clr(123)+BOLD, f.Name, RESET, clr(157), f.ID, RESET, clr(228), f.Release, RESET,
+				f.Uploaded.Format(time.RFC822), strings.Join(f.SupportedVersions, ", "),
+			)
+		}
+		fmt.Println()
+	}
+
+	if format != outputText {
+		return writeOutput(format, records)
+	}
+	return nil
+}
+
+// tagsOf returns the tags of mod id if it is in the modlist
+func (c *cli) tagsOf(id int) []string {
+	if idx := slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == id }); idx != -1 {
+		return c.mods[idx].Tags
+	}
+	return nil
+}
+
+func (c *cli) installed(id int) bool {
+	return slices.ContainsFunc(c.mods, func(m modEntry) bool { return m.Id == id })
+}
+
+func (c *cli) printModInfo(mod cfMod, description string) {
+	installed := ""
+	if c.installed(mod.ID) {
+		installed = fmt.Sprintf(" %s(installed)%s", clr(49), RESET)
+	}
+
+	fmt.Printf("%s%s%s # %s%d%s%s\n", clr(214)+BOLD, mod.Name, RESET, clr(157), mod.ID, RESET, installed)
+	fmt.Printf("%s\n", mod.Summary)
+	fmt.Printf("Downloads: %s%d%s\n", clr(194), mod.DownloadCount, RESET)
+	fmt.Printf("Likes:     %s%d%s\n", clr(194), mod.Likes, RESET)
+	fmt.Printf("Created:   %s%s%s\n", clr(219)+BOLD, mod.Created.Format(time.RFC822), RESET)
+	fmt.Printf("Modified:  %s%s%s\n", clr(219)+BOLD, mod.Modified.Format(time.RFC822), RESET)
+	fmt.Printf("Released:  %s%s%s\n", clr(219)+BOLD, mod.Released.Format(time.RFC822), RESET)
+	for _, f := range mod.Files {
+		fmt.Printf("File:      %s%s%s [%s]\n", clr(123)+BOLD, f.Name, RESET, strings.Join(f.SupportedVersions, ", "))
+	}
+	if description != "" {
+		fmt.Printf("\n%s\n", description)
+	}
+	fmt.Println()
+}
+
+func (c *cli) result(n int) *cfMod {
+	return slc.Get(c.results, n-1)
+}
+
+func (c *cli) resultAt(t *token) (*cfMod, error) {
+	if len(c.results) == 0 {
+		return nil, errors.New("No search results. Run search first")
+	}
+
+	m := c.result(t.parseNumber())
+	if m == nil {
+		return nil, fmt.Errorf("Invalid result index %s. Expected 1-%d", t.val, len(c.results))
+	}
+
+	return m, nil
+}
+
+func (c *cli) updateCmd(ctx context.Context, tokens []token) error {
+	var check bool
+	var ids []int
+	var i int
+	for {
+		t := nextNonSpaceToken(tokens, &i)
+		if t == nil {
+			break
+		}
+
+		switch {
+		case t.typ == Keyword && t.val == "check":
+			check = true
+		case t.typ == Number:
+			ids = append(ids, t.parseNumber())
+		case t.typ != Unknown || t.val != "":
+			return errors.New("Usage: update [check] [id...]")
+		}
+	}
+
+	updates, err := c.findUpdates(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	if len(updates) == 0 {
+		fmt.Printf("%sAll mods are up to date%s\n", clr(46), RESET)
+		return nil
+	}
+
+	if check {
+		fmt.Printf("Found %s%d%s updates (Run %supdate%s to apply them)\n", clr(157), len(updates), RESET, BOLD, RESET)
+		for _, u := range updates {
+			m := c.mods[u.idx]
+			fmt.Printf(
+				"%s%s%s # %s%d%s\n  %s -> %s%s%s (%s)\n",
+				clr(214)+BOLD, m.Name, RESET, clr(157), m.Id, RESET,
+				m.Name, clr(49), u.file.Name, RESET, u.file.Uploaded.Format(time.RFC822),
+			)
+			if err := printChangelogs(ctx, m.Id, u.changes, changelogPreviewLines); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, u := range updates {
+		if err := c.applyUpdate(ctx, u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) changelogCmd(ctx context.Context, tokens []token) error {
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil || t.typ != Number || nextNonSpaceToken(tokens, &i) != nil {
+		return errors.New("Usage: changelog <id>")
+	}
+
+	id := t.parseNumber()
+	idx := slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == id })
+	if idx == -1 {
+		return fmt.Errorf("Mod %d is not in the modlist", id)
+	}
+
+	updates, err := c.findUpdates(ctx, []int{id})
+	if err != nil {
+		return err
+	}
+
+	m := c.mods[idx]
+	if len(updates) == 0 {
+		fmt.Printf("%s%s%s is up to date%s\n", clr(46)+BOLD, m.Name, RESET+clr(46), RESET)
+		return printChangelogs(ctx, id, []CfFile{{ID: m.FileId, Name: m.Name, Uploaded: m.Uploaded}}, 0)
+	}
+
+	u := updates[0]
+	fmt.Printf(
+		"%s%s%s -> %s%s%s (%s%d%s files)\n",
+		clr(214)+BOLD, m.Name, RESET, clr(49), u.file.Name, RESET, clr(157), len(u.changes), RESET,
+	)
+	return printChangelogs(ctx, id, u.changes, 0)
+}
+
+// changelogPreviewLines is how much of each changelog update check shows
+const changelogPreviewLines = 8
+
+// printChangelogs prints the changelog of each file of a mod, cut to limit
+// lines unless limit is 0. A changelog that can't be fetched is reported in
+// its place so the others still show.
+func printChangelogs(ctx context.Context, id int, files []CfFile, limit int) error {
+	for _, f := range files {
+		changelog, err := getChangelog(ctx, id, f.ID, readln.Width()-4)
+		if err != nil && (ctx.Err() != nil || isOffline(err)) {
+			return err
+		}
+
+		fmt.Printf("  %s%s%s (%s)\n", clr(123)+BOLD, f.Name, RESET, f.Uploaded.Format(time.RFC822))
+		if err != nil {
+			fmt.Printf("    %sCould not get changelog: %s%s\n", clr(218), err, RESET)
+			continue
+		}
+		if changelog == "" {
+			fmt.Printf("    %sNo changelog%s\n", clr(248), RESET)
+			continue
+		}
+
+		lines := strings.Split(changelog, "\n")
+		if limit != 0 && len(lines) > limit {
+			lines = append(lines[:limit], fmt.Sprintf("%s... (Run %schangelog %d%s%s for the rest)%s", clr(248), BOLD, id, RESET, clr(248), RESET))
+		}
+		for _, l := range lines {
+			if l == "" {
+				fmt.Println()
+				continue
+			}
+			fmt.Printf("    %s\n", l)
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) checkCmd(ctx context.Context, tokens []token) error {
+	query, err := c.parseTarget(tokens)
+	if err != nil {
+		return errors.New("Usage: check <gameVersion> [modLoader]")
+	}
+
+	if len(c.mods) == 0 {
+		return errors.New("No mods to check")
+	}
+
+	format, err := outputOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	compat, err := c.checkCompat(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if format != outputText {
+		return writeOutput(format, c.compatRecords(compat))
+	}
+
+	var available, unstable int
+	for _, mc := range compat {
+		m := c.mods[mc.idx]
+		switch mc.status {
+		case compatAvailable:
+			available++
+			fmt.Printf("%s+ %s%s%s -> %s%s\n", clr(49), BOLD, m.Name, RESET, mc.file.Name, viaFallback(query, mc.loader))
+		case compatUnstable:
+			unstable++
+			fmt.Printf("%s~ %s%s%s -> %s%s %s(%s only)%s\n", clr(228), BOLD, m.Name, RESET, mc.file.Name, viaFallback(query, mc.loader), clr(228), mc.file.Release, RESET)
+		case compatMissing:
+			if mc.err != nil {
+				fmt.Printf("%s- %s%s%s missing %s(%s)%s\n", clr(219), BOLD, m.Name, RESET, clr(218), mc.err, RESET)
+			} else {
+				fmt.Printf("%s- %s%s%s missing\n", clr(219), BOLD, m.Name, RESET)
+			}
+		}
+	}
+
+	fmt.Printf(
+		"\n%s %s is %s%d%%%s ready: %s%d%s available, %s%d%s beta/alpha only, %s%d%s missing\n",
+		query.GameVersion, modLoaderKeywords[query.ModLoader], BOLD, available*100/len(compat), RESET,
+		clr(49), available, RESET, clr(228), unstable, RESET, clr(219), len(compat)-available-unstable, RESET,
+	)
+	return nil
+}
+
+func (c *cli) migrateCmd(ctx context.Context, tokens []token) error {
+	query, err := c.parseTarget(tokens)
+	if err != nil {
+		return errors.New("Usage: migrate <gameVersion> [modLoader]")
+	}
+
+	if err := c.migrateMods(ctx, query); err != nil {
+		return err
+	}
+
+	c.query = query
+	c.logf("Query Updated: %s\n", c.query)
+	return nil
+}
+
+func viaFallback(query searchQuery, loader int) string {
+	if loader == query.ModLoader {
+		return ""
+	}
+	return fmt.Sprintf(" %svia %s fallback%s", clr(45), modLoaderKeywords[loader], RESET)
+}
+
+func (c *cli) instanceDir() string {
+	if c.instance == "" {
+		return "."
+	}
+	return c.instance
+}
+
+// parseTarget reads a game version and an optional loader, which defaults to
+// the current one.
+func (c *cli) parseTarget(tokens []token) (searchQuery, error) {
+	query := searchQuery{ModLoader: c.query.ModLoader}
+	var i int
+	v := nextNonSpaceToken(tokens, &i)
+	if v == nil || (v.typ != Keyword && v.typ != Symbol) {
+		return query, errors.New("Missing game version")
+	}
+	query.GameVersion = v.val
+
+	if l := nextNonSpaceToken(tokens, &i); l != nil && (l.typ != Unknown || l.val != "") {
+		if l.typ != Keyword {
+			return query, fmt.Errorf("Unknown mod loader %s", l.val)
+		}
+		query.ModLoader = slices.Index(modLoaderKeywords, l.val)
+	}
+
+	return query, nil
+}
+
+func (c *cli) versionCmd(ctx context.Context, tokens []token) error {
+	if len(tokens) == 0 {
+		fmt.Printf(
+			"Found %s%d%s versions locally (Run %sversion update%s to update)\n%s\n",
+			clr(157),
+			len(c.versions),
+			RESET,
+			BOLD,
+			RESET,
+			strings.Join(c.versions, " | "),
+		)
+		return nil
+	}
+
+	if tokens[0].typ == Keyword {
+		versions, err := getVersions(ctx)
+		if isOffline(err) {
+			return c.enqueue("versions update")
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(versions) == len(c.versions) {
+			fmt.Printf("%sUp to date%s\n", clr(46), RESET)
+			return nil
+		}
+
+		var newVersions []string
+		for _, v := range versions {
+			if v.Version == memVersions[0] {
+				break
+			}
+
+			newVersions = append(newVersions, v.Version)
+		}
+
+		c.versions = append(newVersions, c.versions...)
+		if err := c.saveCfg(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var helpTable string
+
+func (c *cli) helpCmd(ctx context.Context, tokens []token) error {
+	if len(helpTable) != 0 {
+		println(helpTable)
+		return nil
+	}
+
+	rows := make([][3]string, len(commands)+2)
+	rows[0] = [3]string{"Command", "Description", " "}
+	rows[1][2] = "-"
+	maxLn := []int{len(rows[0][0]), len(rows[0][1])}
+	for j, cmd := range commands {
+		rows[j+2] = [3]string{cmd.aliases[0], cmd.description, " "}
+		for i, n := range rows[j+2][:2] {
+			l := &maxLn[i]
+			if n := len(n); n > *l {
+				*l = n
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, row := range rows {
+		for i, s := range row[:2] {
+			l := &maxLn[i]
+			sb.WriteString(fmt.Sprintf("|%s%s%s", row[2], s, strings.Repeat(row[2], *l-len(s)+1)))
+		}
+		sb.WriteString("|\n")
+	}
+
+	helpTable = sb.String()
+	return c.helpCmd(ctx, tokens)
+}
+
+func (c *cli) quitCmd(ctx context.Context, tokens []token) error {
+	c.Running = false
+	var i int
+	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == Symbol && t.val == "!" {
+		fmt.Println("Quit without saving")
+		return c.stopBisect()
+	}
+
+	if c.bisect != nil && !c.confirm("A bisection is running. Stop it and quit?") {
+		c.Running = true
+		fmt.Println("Quit cancelled")
+		return nil
+	}
+	if err := c.stopBisect(); err != nil {
+		return err
+	}
+
+	if !c.dirty() {
+		return nil
+	}
+
+	switch c.ask("Save changes to the modlist before quitting? [Y/n/c]") {
+	case "", "y", "yes":
+		return c.saveCmd(ctx, nil)
+	case "n", "no":
+		fmt.Println("Quit without saving")
+		return nil
+	default:
+		c.Running = true
+		fmt.Println("Quit cancelled")
+		return nil
+	}
+}
+
+func (c *cli) saveCmd(context.Context, []token) error {
+	if err := c.saveMods(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %d mods\n", len(c.mods))
+	return nil
+}
+
+func (c *cli) searchCmd(ctx context.Context, tokens []token) error {
+	var i int
+	for i < len(tokens) && tokens[i].typ != Keyword {
+		i++
+	}
+
+	opts := newSearchOptions("")
+	var j int
+	if t := nextNonSpaceToken(tokens[:i], &j); t != nil && t.typ == String {
+		opts.Filter = t.parseString()
+	} else if filter := strings.TrimSpace(joinTokens(tokens[:i])); filter != "" {
+		opts.Filter = filter
+	} else if c.search.PageSize != 0 && i < len(tokens) {
+		opts = c.search
+		opts.Page = 1
+	}
+
+	var prevT *token
+	for {
+		t := nextNonSpaceToken(tokens, &i)
+		if t == nil {
+			break
+		}
+
+		if prevT == nil {
+			if t.typ != Keyword && slices.Contains(searchKeywords, t.val) {
+				return fmt.Errorf("Missing value for search option %s", t.val)
+			}
+			if t.typ != Keyword {
+				return fmt.Errorf("Unexpected search option %#+v", t.val)
+			}
+			prevT = t
+			continue
+		}
+
+		switch prevT.val {
+		case "sort":
+			idx := slices.Index(sortFieldKeywords, t.val)
+			if t.typ != Keyword || idx < 1 {
+				return fmt.Errorf("Invalid sort field %#+v. Expected one of %v", t.val, sortFieldKeywords[1:])
+			}
+			opts.SortField = idx
+		case "order":
+			if t.typ != Keyword {
+				return fmt.Errorf("Invalid sort order %#+v. Expected one of %v", t.val, sortOrderKeywords)
+			}
+			opts.SortOrder = t.val
+		case "tag":
+			if t.typ != Unknown && t.typ != String {
+				return fmt.Errorf("Invalid tag %#+v", t.val)
+			}
+			opts.Tag = t.parseString()
+		case "class":
+			class, ok := classByName(t.val)
+			switch {
+			case t.typ == Keyword && ok:
+				opts.Class = class.id
+			case t.typ == Number:
+				opts.Class = t.parseNumber()
+			default:
+				return fmt.Errorf("Invalid class %#+v. Expected a number or one of %v", t.val, classKeywords)
+			}
+		default:
+			if t.typ != Number {
+				return fmt.Errorf("Invalid %s value %#+v. Expected a number", prevT.val, t.val)
+			}
+			n := t.parseNumber()
+			switch prevT.val {
+			case "page":
+				opts.Page = max(n, 1)
+			case "category":
+				opts.Category = n
+			case "size":
+				opts.PageSize = min(max(n, 1), maxPageSize)
+			}
+		}
+		prevT = nil
+	}
+
+	if prevT != nil {
+		return fmt.Errorf("Missing value for search option %s", prevT.val)
+	}
+
+	return c.runSearch(ctx, opts)
+}
+
+func (c *cli) nextCmd(ctx context.Context, _ []token) error {
+	if c.search.PageSize == 0 {
+		return errors.New("No previous search")
+	}
+
+	if c.search.Page >= c.page.pages() {
+		return errors.New("Already on the last page")
+	}
+
+	opts := c.search
+	opts.Page++
+	return c.runSearch(ctx, opts)
+}
+
+func (c *cli) prevCmd(ctx context.Context, _ []token) error {
+	if c.search.PageSize == 0 {
+		return errors.New("No previous search")
+	}
+
+	if c.search.Page <= 1 {
+		return errors.New("Already on the first page")
+	}
+
+	opts := c.search
+	opts.Page--
+	return c.runSearch(ctx, opts)
+}
+
+func (c *cli) runSearch(ctx context.Context, opts searchOptions) error {
+	if opts.Page*opts.PageSize > maxSearchResults {
+		return fmt.Errorf("Page %d is out of range. CurseForge only returns the first %d results", opts.Page, maxSearchResults)
+	}
+
+	format, err := outputOf(ctx)
+	if err != nil {
+		return err
+	}
+
+	var mods []cfMod
+	var page cfPagination
+	if opts.Tag != "" {
+		mods, page, err = c.searchTagged(ctx, opts)
+	} else {
+		mods, page, err = searchMods(ctx, opts, c.query)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.search = opts
+	c.results = mods
+	c.page = page
+
+	if format != outputText {
+		records := make([]searchRecord, 0, len(mods))
+		for i, mod := range mods {
+			records = append(records, c.searchRecord(i, mod))
+		}
+		return writeOutput(format, records)
+	}
+
+	for i, mod := range mods {
+		var class string
+		if mod.Class != classMod {
+			class = fmt.Sprintf(" %s(%s)%s", clr(228), classOf(mod.Class).name, RESET)
+		}
+		fmt.Printf("%s%d.%s [%sID: %s%d%s] %s%s\n%sDownloads: %s%d\n%s%s\n", clr(157)+BOLD, i+1, RESET, clr(218), clr(194), mod.ID, RESET, mod.Name, class, clr(218), clr(194), mod.DownloadCount, RESET, mod.Summary)
+		if tags := c.tagsOf(mod.ID); len(tags) != 0 {
+			fmt.Printf("%sTags: %s%s%s\n", clr(218), clr(117), strings.Join(tags, ", "), RESET)
+		}
+		fmt.Println()
+	}
+
+	if opts.Tag != "" {
+		fmt.Printf("Page %s%d%s of %s%d%s (%d results tagged %s)\n", clr(157), opts.Page, RESET, clr(157), page.pages(), RESET, page.TotalCount, opts.Tag)
+		return nil
+	}
+	fmt.Printf(
+		"Page %s%d%s of %s%d%s (%d results sorted by %s %s)\n",
+		clr(157), opts.Page, RESET,
+		clr(157), page.pages(), RESET,
+		page.TotalCount,
+		sortFieldKeywords[opts.SortField],
+		opts.SortOrder,
+	)
+	return nil
+}
+
+// searchTagged searches the modlist entries tagged opts.Tag instead of
+// CurseForge, keeping the ones whose project name has the filter and class in
+// them. Results are in modlist order and paged like a CurseForge search.
+func (c *cli) searchTagged(ctx context.Context, opts searchOptions) ([]cfMod, cfPagination, error) {
+	var mods []cfMod
+	for _, m := range c.mods {
+		if !m.hasTag(opts.Tag) {
+			continue
+		}
+
+		mod, err := getMod(ctx, m.Id)
+		if err != nil {
+			return nil, cfPagination{}, err
+		}
+		if containsFold(mod.Name, opts.Filter) && (opts.Class == 0 || classOf(mod.Class).id == classOf(opts.Class).id) {
+			mods = append(mods, mod)
+		}
+	}
+
+	page := cfPagination{Index: (opts.Page - 1) * opts.PageSize, PageSize: opts.PageSize, TotalCount: len(mods)}
+	mods = mods[min(page.Index, len(mods)):min(page.Index+opts.PageSize, len(mods))]
+	page.ResultCount = len(mods)
+	return mods, page, nil
+}
+
+func (c *cli) setQueryCmd(ctx context.Context, tokens []token) error {
+	if len(tokens) == 0 {
+		fmt.Println(c.query)
+		fmt.Println("offline:", onOff(c.offline))
+		fmt.Println("autosave:", onOff(c.autosave))
+		fmt.Println("fallback:", c.fallbackString())
+		fmt.Println("instance:", c.instanceDir())
+		if c.metaURL != "" {
+			fmt.Println("meta:", c.metaURL)
+		}
+		return nil
+	}
+
+	var queryChanged, cfgChanged bool
+
+	for i := 0; i < len(tokens); i++ {
+		k := nextNonSpaceToken(tokens, &i)
+		if k.typ == Ident {
+			v := nextNonSpaceToken(tokens, &i)
+			if v == nil {
+				return errors.New("Missing value")
+			}
+
+			switch k.val {
+			case "gameVersion":
+				if v.typ != Keyword {
+					return fmt.Errorf("Invalid value %+v", v)
+				}
+				c.query.GameVersion = v.val
+				queryChanged = true
+			case "modLoader":
+				if v.typ != Keyword {
+					return errors.New("Invalid value")
+				}
+				c.query.ModLoader = slices.Index(modLoaderKeywords, v.val)
+				queryChanged = true
+			case "offline":
+				if v.typ != Keyword {
+					return errors.New("Invalid value. Expected on or off")
+				}
+				wasOffline := c.offline
+				c.SetOffline(v.val == "on")
+				fmt.Println("Offline mode", onOff(c.offline))
+				if wasOffline && !c.offline {
+					if err := c.replayQueue(ctx); err != nil {
+						return err
+					}
+				}
+			case "autosave":
+				if v.typ != Keyword {
+					return errors.New("Invalid value. Expected on or off")
+				}
+				c.autosave = v.val == "on"
+				cfgChanged = true
+				fmt.Println("Autosave", onOff(c.autosave))
+			case "instance":
+				if v.typ != String {
+					return errors.New("Usage: set instance \"directory\"")
+				}
+				c.instance = v.parseString()
+				cfgChanged = true
+				fmt.Println("Instance:", c.instanceDir())
+			case "meta":
+				if v.typ != String {
+					return errors.New("Usage: set meta \"url\". An empty url goes back to the official servers")
+				}
+				c.metaURL = v.parseString()
+				cfgChanged = true
+				fmt.Println("Meta server:", cmp.Or(c.metaURL, "official"))
+			case "fallback":
+				loader := slices.Index(modLoaderKeywords, v.val)
+				if v.typ != Keyword || loader < 1 {
+					return errors.New("Usage: set fallback <modLoader> <fallbackLoader...|none>")
+				}
+
+				var chain []int
+				for t := nextNonSpaceToken(tokens, &i); t != nil; t = nextNonSpaceToken(tokens, &i) {
+					if t.typ == Unknown && t.val == "" || t.val == "none" {
+						continue
+					}
+					if l := slices.Index(modLoaderKeywords, t.val); t.typ == Keyword && l > 0 && l != loader {
+						chain = append(chain, l)
+						continue
+					}
+					return fmt.Errorf("Invalid fallback loader %s", t.val)
+				}
+
+				c.fallbacks[loader] = chain
+				cfgChanged = true
+				fmt.Println("Fallback:", c.fallbackString())
+			}
+		} else {
+			return fmt.Errorf("Unknown query key %s", k.val)
+		}
+	}
+
+	if queryChanged {
+		fmt.Println("Query Updated:", c.query)
+	} else if !cfgChanged {
+		return nil
+	}
+
+	return c.saveCfg()
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func (c *cli) cacheCmd(ctx context.Context, tokens []token) error {
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil {
+		t = &token{typ: Keyword, val: "stats"}
+	}
+
+	if t.typ != Keyword {
+		return errors.New("Usage: cache <stats|clear|ttl> [endpoint duration]")
+	}
+
+	switch t.val {
+	case "stats":
+		stats, err := httpCache.Stats()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Entries:     %s%d%s (%d fresh, %.1f KiB)\n", clr(157), stats.Entries, RESET, stats.Fresh, float64(stats.Bytes)/1024)
+		fmt.Printf("Hits:        %s%d%s\n", clr(49), stats.Hits, RESET)
+		fmt.Printf("Revalidated: %s%d%s\n", clr(45), stats.Revalidated, RESET)
+		fmt.Printf("Misses:      %s%d%s\n", clr(218), stats.Misses, RESET)
+	case "clear":
+		n, err := httpCache.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s%d%s cached responses\n", clr(157), n, RESET)
+	case "ttl":
+		name := nextNonSpaceToken(tokens, &i)
+		if name == nil {
+			for _, r := range httpCache.Rules {
+				fmt.Printf("%s%-9s%s %s%s%s\t%s\n", clr(228)+BOLD, r.Name, RESET, clr(157), r.TTL, RESET, r.Pattern)
+			}
+			fmt.Printf("%s%-9s%s %s%s%s\n", clr(228)+BOLD, "default", RESET, clr(157), httpCache.DefaultTTL, RESET)
+			return nil
+		}
+
+		ttl, err := time.ParseDuration(strings.TrimSpace(joinTokens(tokens[i:])))
+		if err != nil {
+			return fmt.Errorf("Invalid duration: %w", err)
+		}
+
+		if err := httpCache.SetTTL(name.val, ttl); err != nil {
+			return err
+		}
+		fmt.Printf("Cache TTL for %s set to %s\n", name.val, ttl)
+	}
+
+	return nil
+}
+
+func (c *cli) restoreCmd(ctx context.Context, tokens []token) error {
+	name := modlistFile
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t != nil && t.typ == Keyword {
+		name = t.val
+		t = nextNonSpaceToken(tokens, &i)
+	}
+
+	if t == nil || t.typ != Number {
+		return listBackups()
+	}
+
+	n := t.parseNumber()
+	data, err := os.ReadFile(backupName(name, n))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("No backup %d of %s. Run restore to list them", n, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case modlistFile:
+		mods, _, err := decodeMods(data)
+		if err != nil {
+			return err
+		}
+		c.mutate(fmt.Sprintf("restore %d", n), func() error {
+			c.mods = mods
+			return nil
+		})
+		if err := c.saveMods(); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s%d%s mods from backup %d\n", clr(157), len(mods), RESET, n)
+	case cfgFile:
+		cfg, _, err := decodeCfg(data)
+		if err != nil {
+			return err
+		}
+		c.config = cfg
+		if err := c.saveCfg(); err != nil {
+			return err
+		}
+		fmt.Println("Restored cfg from backup", n, c.query)
+	}
+
+	return nil
+}
+
+func listBackups() error {
+	for _, name := range []string{modlistFile, cfgFile} {
+		fmt.Printf("%s%s%s\n", clr(228)+BOLD, name, RESET)
+		for n := 1; n <= backupCount; n++ {
+			info, err := os.Stat(backupName(name, n))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("  %s%d%s %s", clr(157)+BOLD, n, RESET, info.ModTime().Format(time.DateTime))
+			if name == modlistFile {
+				data, err := os.ReadFile(backupName(name, n))
+				if err != nil {
+					return err
+				}
+				if mods, _, err := decodeMods(data); err != nil {
+					fmt.Printf(" %s(corrupt)%s", clr(218), RESET)
+				} else {
+					fmt.Printf(" (%d mods)", len(mods))
+				}
+			}
+			fmt.Println()
+		}
+	}
+
+	fmt.Printf("Run %srestore [modlist|cfg] <n>%s to roll back\n", BOLD, RESET)
+	return nil
+}
+
+func (c *cli) debugCmd(context.Context, []token) error {
 	c.dbg = !c.dbg
 	if c.dbg {
 		println("Debug enabled")
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stuff7/mcman/slc"
+)
+
+// CurseForge classIds of Minecraft content
+const (
+	classMod          = 6
+	classResourcePack = 12
+	classWorld        = 17
+	classShaderPack   = 6552
+	classDatapack     = 6945
+)
+
+// contentClass describes where a kind of content goes in an instance. side is
+// the side content of this class always runs on, if any.
+type contentClass struct {
+	id   int
+	name string
+	dir  string
+	side side
+}
+
+var contentClasses = []contentClass{
+	{classMod, "mod", "mods", sideUnknown},
+	{classResourcePack, "resourcepack", "resourcepacks", sideClient},
+	{classShaderPack, "shaderpack", "shaderpacks", sideClient},
+	{classDatapack, "datapack", "datapacks", sideBoth},
+	{classWorld, "world", "saves", sideBoth},
+}
+
+var classKeywords = []string{"mod", "resourcepack", "shaderpack", "datapack", "world"}
+
+// classOf returns the class with the given id. Entries saved before classes
+// were tracked have id 0 and are mods.
+func classOf(id int) contentClass {
+	if id == 0 {
+		id = classMod
+	}
+
+	if idx := slices.IndexFunc(contentClasses, func(c contentClass) bool { return c.id == id }); idx != -1 {
+		return contentClasses[idx]
+	}
+	return contentClass{id: id, name: fmt.Sprintf("class %d", id)}
+}
+
+func classByName(name string) (contentClass, bool) {
+	idx := slices.IndexFunc(contentClasses, func(c contentClass) bool { return c.name == name })
+	if idx == -1 {
+		return contentClass{}, false
+	}
+	return contentClasses[idx], true
+}
+
+// target returns query as it applies to m. Only mods depend on a loader.
+func (m modEntry) target(query searchQuery) searchQuery {
+	if classOf(m.Class).id != classMod {
+		query.ModLoader = loaderAny
+	}
+	return query
+}
+
+// installPaths returns where m goes under the instance root. Datapacks tied to
+// worlds go into the datapacks directory of each of them instead.
+func installPaths(root string, m modEntry) []string {
+	name := url.QueryEscape(m.Name)
+	if classOf(m.Class).id == classDatapack && len(m.Worlds) != 0 {
+		return slc.Map(m.Worlds, func(w string) string { return filepath.Join(root, "saves", w, "datapacks", name) })
+	}
+	return []string{filepath.Join(root, classOf(m.Class).dir, name)}
+}
+
+type world struct {
+	name      string
+	datapacks []string
+}
+
+// readWorlds lists the worlds in the saves directory of an instance along with
+// the datapacks installed in each.
+func readWorlds(root string) ([]world, error) {
+	saves, err := os.ReadDir(filepath.Join(root, "saves"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var worlds []world
+	for _, s := range saves {
+		if !s.IsDir() {
+			continue
+		}
+
+		w := world{name: s.Name()}
+		packs, err := os.ReadDir(filepath.Join(root, "saves", s.Name(), "datapacks"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, p := range packs {
+			w.datapacks = append(w.datapacks, p.Name())
+		}
+		worlds = append(worlds, w)
+	}
+
+	return worlds, nil
+}
+
+func validDirName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// extractZip extracts every file of the zip at path into dir, keeping files
+// that already exist.
+func extractZip(path, dir string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		name := filepath.Join(dir, f.Name)
+		if !strings.HasPrefix(name, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("Invalid file path %s in %s", f.Name, path)
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(name, 0777); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := os.Stat(name); err == nil {
+			continue
+		}
+
+		if err := extractZipFile(f, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractZipFile(f *zip.File, name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, rc)
+	return err
+}
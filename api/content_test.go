@@ -0,0 +1,109 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// zipOf returns a zip archive holding files
+func zipOf(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAddClass(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1":                    cfMod{ID: 1, Name: "Faithful", Class: classResourcePack},
+		"/v1/mods/1/files 1.20.1 Any":   []CfFile{{ID: 11, Name: "faithful.zip"}},
+		"/v1/mods/1/files 1.20.1 Forge": []CfFile{{ID: 12, Name: "wrong.zip"}},
+	})
+	c := newTestCli(t, "y")
+	c.query = searchQuery{GameVersion: "1.20.1", ModLoader: loaderForge}
+	if err := c.run(t, "add id 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.mods) != 1 {
+		t.Fatalf("Returned %d mods\nExpected: 1", len(c.mods))
+	}
+	if m := c.mods[0]; m.Name != "faithful.zip" || m.Class != classResourcePack || m.ModLoader != loaderAny || m.Side != sideClient {
+		t.Errorf("Returned: %+v\nExpected a client side resource pack added without a loader", m)
+	}
+}
+
+func TestDownloadRouting(t *testing.T) {
+	fakeDownloads(t, map[string][]byte{
+		"/a.jar":   zipOf(t, "fabric.mod.json"),
+		"/b.zip":   zipOf(t, "pack.mcmeta"),
+		"/c.zip":   zipOf(t, "shaders/final.fsh"),
+		"/d.zip":   zipOf(t, "data/d/functions/tick.mcfunction"),
+		"/e.zip":   zipOf(t, "MyWorld/level.dat", "MyWorld/region/r.0.0.mca"),
+		"/new.jar": zipOf(t, "fabric.mod.json"),
+	})
+	c := newTestCli(t, "y")
+	c.instance = "instance"
+	for _, m := range []modEntry{
+		{Id: 1, Name: "a.jar", Class: classMod},
+		{Id: 2, Name: "b.zip", Class: classResourcePack},
+		{Id: 3, Name: "c.zip", Class: classShaderPack},
+		{Id: 4, Name: "d.zip", Class: classDatapack},
+		{Id: 5, Name: "e.zip", Class: classWorld},
+		{Id: 6, Name: "old.jar", Class: 0},
+	} {
+		m.DownloadUrl = "https://example.com/" + m.Name
+		if m.Id == 6 {
+			m.DownloadUrl = "https://example.com/new.jar"
+		}
+		c.mods = append(c.mods, m)
+	}
+
+	captureStdout(t, func() {
+		if err := c.run(t, "download"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	for _, path := range []string{
+		"mods/a.jar",
+		"resourcepacks/b.zip",
+		"shaderpacks/c.zip",
+		"datapacks/d.zip",
+		"saves/e.zip",
+		"saves/MyWorld/level.dat",
+		"saves/MyWorld/region/r.0.0.mca",
+		"mods/old.jar",
+	} {
+		if _, err := os.Stat(filepath.Join("instance", path)); err != nil {
+			t.Errorf("Expected %s in the instance\nerr: %s", path, err)
+		}
+	}
+}
+
+func TestExtractZipOutside(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "world.zip")
+	if err := os.WriteFile(path, zipOf(t, "../evil.txt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractZip(path, filepath.Join(dir, "saves")); err == nil {
+		t.Error("Expected an error for a file outside the saves directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); err == nil {
+		t.Error("A file was extracted outside the saves directory")
+	}
+}
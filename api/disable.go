@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/stuff7/mcman/slc"
+)
+
+// disabledExt is appended to the files of disabled entries so the game skips
+// them while they stay in the instance.
+const disabledExt = ".disabled"
+
+// setDisabled renames the file at path to or from its disabled name. Missing
+// files are left alone, but a file whose other name is taken too is an error
+// since either of them could be the one to keep.
+func setDisabled(path string, disabled bool) error {
+	from, to := path+disabledExt, path
+	if disabled {
+		from, to = to, from
+	}
+
+	if _, err := os.Stat(from); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("Both %s and %s exist, remove one of them", from, to)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return os.Rename(from, to)
+}
+
+// syncDisabled renames the files in the instance of every entry op added so
+// they match whether the entry is disabled.
+func (c *cli) syncDisabled(op modOp) error {
+	var errs []error
+	for _, ch := range op.added {
+		if classOf(ch.mod.Class).id == classWorld {
+			continue
+		}
+		for _, path := range installPaths(c.instanceDir(), ch.mod) {
+			errs = append(errs, setDisabled(path, ch.mod.Disabled))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// modArgs finds the mods whose ids are the words of tokens
+func (c *cli) modArgs(tokens []token, usage string) ([]*modEntry, error) {
+	ws := words(tokens)
+	if len(ws) == 0 {
+		return nil, errors.New(usage)
+	}
+
+	var mods []*modEntry
+	for _, w := range ws {
+		if len(w) != 1 || w[0].typ != Number {
+			return nil, errors.New(usage)
+		}
+
+		id := w[0].parseNumber()
+		idx := slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == id })
+		if idx == -1 {
+			return nil, fmt.Errorf("Could not find mod with id %d", id)
+		}
+		if classOf(c.mods[idx].Class).id == classWorld {
+			return nil, fmt.Errorf("%s is a world, worlds can't be disabled", c.mods[idx].Name)
+		}
+		mods = append(mods, &c.mods[idx])
+	}
+
+	return mods, nil
+}
+
+func (c *cli) disableCmd(ctx context.Context, tokens []token) error {
+	mods, err := c.modArgs(tokens, "Usage: disable <id...>")
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mods {
+		m.Disabled = true
+		fmt.Printf("%s%s%s disabled\n", BOLD, m.Name, RESET)
+	}
+	for _, m := range mods {
+		for _, d := range c.mods {
+			if !d.Disabled && slices.Contains(d.Deps, m.Id) {
+				fmt.Printf("%s! %s%s%s requires %s, which is disabled%s\n", clr(227), BOLD, d.Name, RESET+clr(227), m.Name, RESET)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) enableCmd(ctx context.Context, tokens []token) error {
+	mods, err := c.modArgs(tokens, "Usage: enable <id...>")
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mods {
+		m.Disabled = false
+		fmt.Printf("%s%s%s enabled\n", BOLD, m.Name, RESET)
+	}
+	for _, m := range mods {
+		for _, d := range c.mods {
+			if d.Disabled && slices.Contains(m.Deps, d.Id) {
+				fmt.Printf("%s! %s%s%s requires %s, which is disabled%s\n", clr(227), BOLD, m.Name, RESET+clr(227), d.Name, RESET)
+			}
+		}
+	}
+
+	return nil
+}
+
+// bisection looks for the mod causing a problem by disabling part of the
+// suspects at each step and keeping the part the answer points to.
+type bisection struct {
+	disabled []int // ids disabled before the bisection started
+	suspects []int
+	step     []int // ids disabled for the current step
+	steps    int
+}
+
+// dependents returns ids along with the ids of every mod that requires one of
+// them, directly or not. Those can't run while ids are disabled.
+func dependents(mods []modEntry, ids []int) []int {
+	ids = slices.Clone(ids)
+	for changed := true; changed; {
+		changed = false
+		for _, m := range mods {
+			if !slices.Contains(ids, m.Id) && slices.ContainsFunc(m.Deps, func(d int) bool { return slices.Contains(ids, d) }) {
+				ids = append(ids, m.Id)
+				changed = true
+			}
+		}
+	}
+	return ids
+}
+
+func countIn(ids, set []int) int {
+	return len(slc.Filter(ids, func(id int) bool { return slices.Contains(set, id) }))
+}
+
+// split picks what to disable next: about half of the suspects along with
+// their dependents, leaving at least one suspect enabled. It returns nil when
+// the suspects can't be told apart.
+func (b *bisection) split(mods []modEntry) []int {
+	half := (len(b.suspects) + 1) / 2
+	var picked, step []int
+	for _, id := range b.suspects {
+		next := dependents(mods, append(slices.Clone(picked), id))
+		n := countIn(b.suspects, next)
+		if n == len(b.suspects) {
+			continue
+		}
+
+		picked = append(picked, id)
+		step = next
+		if n >= half {
+			break
+		}
+	}
+	return step
+}
+
+// apply disables the mods of the current step and enables every other one
+// that was enabled when the bisection started.
+func (b *bisection) apply(mods []modEntry) {
+	for i := range mods {
+		m := &mods[i]
+		if classOf(m.Class).id != classWorld {
+			m.Disabled = slices.Contains(b.disabled, m.Id) || slices.Contains(b.step, m.Id)
+		}
+	}
+}
+
+func (b *bisection) reset(mods []modEntry) {
+	b.step = nil
+	b.apply(mods)
+}
+
+// bisectCmd runs a bisection step. Steps rename files like disable does but
+// stay out of the undo history, since undoing one would leave the bisection
+// pointing at mods that are no longer disabled.
+func (c *cli) bisectCmd(ctx context.Context, tokens []token) error {
+	before := cloneMods(c.mods)
+	err := c.bisectStep(tokens)
+	return errors.Join(err, c.syncDisabled(diffMods("bisect", before, c.mods)))
+}
+
+func (c *cli) bisectStep(tokens []token) error {
+	usage := errors.New("Usage: bisect [start [filter...]|good|bad|reset]")
+	ws := words(tokens)
+	if len(ws) == 0 {
+		return c.bisectStatus()
+	}
+
+	b := c.bisect
+	switch joinTokens(ws[0]) {
+	case "start":
+		if b != nil {
+			return errors.New("A bisection is already running. Run bisect reset to stop it")
+		}
+
+		var rest []token
+		if len(ws) > 1 {
+			rest = tokens[slices.IndexFunc(tokens, func(t token) bool { return t.lst == ws[1][0].lst }):]
+		}
+		filter, err := c.parseModFilter(rest)
+		if err != nil {
+			return err
+		}
+
+		b = &bisection{}
+		for _, m := range c.mods {
+			if m.Disabled {
+				b.disabled = append(b.disabled, m.Id)
+			}
+		}
+		for _, i := range filter.apply(c.mods) {
+			if m := c.mods[i]; !m.Disabled && !m.Stranded && classOf(m.Class).id != classWorld {
+				b.suspects = append(b.suspects, m.Id)
+			}
+		}
+		if len(b.suspects) < 2 {
+			return fmt.Errorf("Need at least 2 enabled mods to bisect, found %d", len(b.suspects))
+		}
+	case "good", "bad":
+		if b == nil {
+			return errors.New("No bisection running. Start one with bisect start")
+		}
+
+		gone := joinTokens(ws[0]) == "good"
+		b.suspects = slc.Filter(b.suspects, func(id int) bool {
+			return slices.Contains(b.step, id) == gone && slices.ContainsFunc(c.mods, func(m modEntry) bool { return m.Id == id })
+		})
+		if len(b.suspects) <= 1 {
+			b.reset(c.mods)
+			c.bisect = nil
+			if len(b.suspects) == 0 {
+				return errors.New("No suspects left in the modlist. Every mod is back as it was before bisect start")
+			}
+			m := c.mods[slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == b.suspects[0] })]
+			fmt.Printf("Found %s%s%s # %s%d%s after %d steps. Every mod is back as it was before bisect start\n", clr(214)+BOLD, m.Name, RESET, clr(157), m.Id, RESET, b.steps)
+			return nil
+		}
+	case "reset":
+		if b == nil {
+			return errors.New("No bisection running")
+		}
+
+		return c.stopBisect()
+	default:
+		return usage
+	}
+
+	b.step = b.split(c.mods)
+	if b.step == nil {
+		b.reset(c.mods)
+		c.bisect = nil
+		return fmt.Errorf("Could not split %d suspects that require each other: %s", len(b.suspects), strings.Join(c.modNames(b.suspects), ", "))
+	}
+
+	b.steps++
+	b.apply(c.mods)
+	c.bisect = b
+
+	fmt.Printf("Step %d: disabled %s%d%s mods, %s%d%s suspects left (about %d more steps)\n", b.steps, clr(219), len(b.step), RESET, clr(49), len(b.suspects), RESET, bits.Len(uint(len(b.suspects)-1)))
+	fmt.Printf("Run the game, then %sbisect good%s if the problem is gone or %sbisect bad%s if it is still there\n", BOLD, RESET, BOLD, RESET)
+	return nil
+}
+
+// stopBisect ends the running bisection, if any, putting back every mod as it
+// was before bisect start.
+func (c *cli) stopBisect() error {
+	if c.bisect == nil {
+		return nil
+	}
+
+	before := cloneMods(c.mods)
+	c.bisect.reset(c.mods)
+	c.bisect = nil
+	fmt.Println("Bisection stopped. Every mod is back as it was before bisect start")
+	return c.syncDisabled(diffMods("bisect reset", before, c.mods))
+}
+
+func (c *cli) bisectStatus() error {
+	b := c.bisect
+	if b == nil {
+		fmt.Printf("No bisection running. Run %sbisect start [filter...]%s to look for the mod causing a problem\n", BOLD, RESET)
+		return nil
+	}
+
+	fmt.Printf("Step %d, %s%d%s suspects left: %s\n", b.steps, clr(49), len(b.suspects), RESET, strings.Join(c.modNames(b.suspects), ", "))
+	fmt.Printf("Disabled for this step: %s\n", strings.Join(c.modNames(b.step), ", "))
+	return nil
+}
+
+func (c *cli) modNames(ids []int) []string {
+	return slc.Map(ids, func(id int) string {
+		if idx := slices.IndexFunc(c.mods, func(m modEntry) bool { return m.Id == id }); idx != -1 {
+			return c.mods[idx].Name
+		}
+		return fmt.Sprint(id)
+	})
+}
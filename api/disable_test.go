@@ -0,0 +1,157 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSetDisabledConflict(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.jar")
+	for _, p := range []string{path, path + disabledExt} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, disabled := range []bool{true, false} {
+		err := setDisabled(path, disabled)
+		if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), path+disabledExt) {
+			t.Errorf("Disabled %v\nReturned: %v\nExpected an error naming both files", disabled, err)
+		}
+	}
+}
+
+// testBisect returns a cli with mods 1 to 6 installed, where 6 is disabled
+// and 2 requires 1.
+func testBisect(t *testing.T, answer string) *cli {
+	c := newTestCli(t, answer)
+	if err := os.Mkdir("mods", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= 6; id++ {
+		m := modEntry{Id: id, Name: string(rune('a'+id-1)) + ".jar", Disabled: id == 6}
+		if id == 2 {
+			m.Deps = []int{1}
+		}
+		c.mods = append(c.mods, m)
+
+		path := installPaths(".", m)[0]
+		if m.Disabled {
+			path += disabledExt
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// checkDisabled checks both the modlist and the files agree that exactly ids
+// are disabled.
+func checkDisabled(t *testing.T, c *cli, step string, ids []int) {
+	t.Helper()
+	for _, m := range c.mods {
+		want := slices.Contains(ids, m.Id)
+		_, err := os.Stat(installPaths(".", m)[0] + disabledExt)
+		if m.Disabled != want || (err == nil) != want {
+			t.Errorf("%s\nMod %d: disabled %v, disabled file %v\nExpected: %v", step, m.Id, m.Disabled, err == nil, want)
+		}
+	}
+}
+
+func disabledIds(c *cli) []int {
+	var ids []int
+	for _, m := range c.mods {
+		if m.Disabled {
+			ids = append(ids, m.Id)
+		}
+	}
+	return ids
+}
+
+func TestBisect(t *testing.T) {
+	for _, culprit := range []int{1, 2, 3, 5} {
+		c := testBisect(t, "y")
+		out := captureStdout(t, func() {
+			if err := c.run(t, "bisect start"); err != nil {
+				t.Fatal(err)
+			}
+			for steps := 0; c.bisect != nil; steps++ {
+				if steps > 5 {
+					t.Fatalf("Culprit %d: no answer after %d steps", culprit, steps)
+				}
+				checkDisabled(t, c, "Step", disabledIds(c))
+
+				answer := "bisect bad"
+				if slices.Contains(c.bisect.step, culprit) {
+					answer = "bisect good"
+				}
+				if err := c.run(t, answer); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+
+		if want := "Found " + clr(214) + BOLD + c.mods[culprit-1].Name; !strings.Contains(out, want) {
+			t.Errorf("Culprit %d\nReturned:\n%s\nExpected: %q", culprit, out, want)
+		}
+		checkDisabled(t, c, "Found", []int{6})
+		if len(c.undoOps) != 0 {
+			t.Errorf("Culprit %d: bisect left %d undo operations", culprit, len(c.undoOps))
+		}
+	}
+}
+
+func TestBisectUndo(t *testing.T) {
+	c := testBisect(t, "y")
+	if err := c.run(t, "disable 5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run(t, "bisect start"); err != nil {
+		t.Fatal(err)
+	}
+
+	step := disabledIds(c)
+	for _, line := range []string{"undo", "redo"} {
+		if err := c.run(t, line); err != errBisecting {
+			t.Errorf("%s during a bisection\nReturned: %v\nExpected: %s", line, err, errBisecting)
+		}
+	}
+	checkDisabled(t, c, "After undo", step)
+	if err := c.run(t, "bisect bad"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.run(t, "bisect reset"); err != nil {
+		t.Fatal(err)
+	}
+	checkDisabled(t, c, "After reset", []int{5, 6})
+	if err := c.run(t, "undo"); err != nil {
+		t.Fatal(err)
+	}
+	checkDisabled(t, c, "Undo disable", []int{6})
+}
+
+func TestBisectQuit(t *testing.T) {
+	c := testBisect(t, "y")
+	if err := c.run(t, "bisect start"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run(t, "quit"); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.bisect != nil || c.Running {
+		t.Fatalf("Quit left bisection %v, running %v", c.bisect, c.Running)
+	}
+	checkDisabled(t, c, "After quit", []int{6})
+	c.mods = nil
+	if err := c.readMods(); err != nil {
+		t.Fatal(err)
+	}
+	checkDisabled(t, c, "Saved", []int{6})
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestFallbackFiles(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1/files 1.20.1 Quilt":  []CfFile{{ID: 11, Name: "a-quilt.jar"}},
+		"/v1/mods/1/files 1.20.1 Fabric": []CfFile{{ID: 12, Name: "a-fabric.jar"}},
+		"/v1/mods/2/files 1.20.1 Quilt":  []CfFile{},
+		"/v1/mods/2/files 1.20.1 Fabric": []CfFile{{ID: 22, Name: "b-fabric.jar"}},
+		"/v1/mods/3/files 1.20.1 Quilt":  []CfFile{},
+		"/v1/mods/3/files 1.20.1 Fabric": []CfFile{},
+	})
+	c := newTestCli(t, "y")
+	query := searchQuery{GameVersion: "1.20.1", ModLoader: loaderQuilt}
+
+	for _, tt := range []struct {
+		id     int
+		loader int
+		file   string
+	}{
+		{1, loaderQuilt, "a-quilt.jar"},
+		{2, loaderFabric, "b-fabric.jar"},
+		{3, loaderQuilt, ""},
+	} {
+		files, err := c.getModFilesFallback(context.Background(), tt.id, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var file string
+		if len(files.Files) != 0 {
+			file = files.Files[0].Name
+		}
+		if files.ModLoader != tt.loader || file != tt.file {
+			t.Errorf("Mod %d\nReturned: %s %q\nExpected: %s %q", tt.id, modLoaderKeywords[files.ModLoader], file, modLoaderKeywords[tt.loader], tt.file)
+		}
+	}
+
+	c.fallbacks = map[int][]int{}
+	if files, err := c.getModFilesFallback(context.Background(), 2, query); err != nil || len(files.Files) != 0 {
+		t.Errorf("Without fallbacks\nReturned: %+v, %v\nExpected no files", files.Files, err)
+	}
+}
+
+func TestAddFallback(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/2":                     cfMod{ID: 2, Name: "B", Class: classMod},
+		"/v1/mods/2/files 1.20.1 Quilt":  []CfFile{},
+		"/v1/mods/2/files 1.20.1 Fabric": []CfFile{{ID: 22, Name: "b-fabric.jar"}},
+	})
+	c := newTestCli(t, "y")
+	c.query = searchQuery{GameVersion: "1.20.1", ModLoader: loaderQuilt}
+	if err := c.run(t, "add id 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []modRecord
+	out := captureStdout(t, func() {
+		if err := c.run(t, "list --json"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if len(records) != 1 || records[0].Loader != "Quilt" || records[0].Fallback != "Fabric" {
+		t.Errorf("Returned: %+v\nExpected a Quilt entry resolved through the Fabric fallback", records)
+	}
+}
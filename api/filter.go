@@ -0,0 +1,493 @@
+package api
+
+import (
+	"cmp"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stuff7/mcman/slc"
+)
+
+var listKeywords = []string{"where", "sort", "top-level", "deps-only", "search", "id", "side", "tag"}
+
+var filterOps = []string{"=", "!=", "<", "<=", ">", ">=", "~"}
+
+// filterAliases are the names list accepts for modEntry fields besides the
+// ones they have in the modlist
+var filterAliases = map[string]string{"loader": "modLoader"}
+
+// filterFields are the json names of every modEntry field and their aliases
+var filterFields = func() []string {
+	typ := reflect.TypeFor[modEntry]()
+	fields := make([]string, 0, typ.NumField()+len(filterAliases))
+	for i := range typ.NumField() {
+		fields = append(fields, jsonName(typ.Field(i)))
+	}
+	for alias := range filterAliases {
+		fields = append(fields, alias)
+	}
+	slices.Sort(fields)
+	return fields
+}()
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// modFilter selects and orders entries of the modlist
+type modFilter struct {
+	conds []func(m modEntry) bool
+	sort  int
+	desc  bool
+}
+
+// apply returns the indices of the mods that pass every condition, in the
+// order of the sort field if there is one.
+func (f modFilter) apply(mods []modEntry) []int {
+	var idxs []int
+	for i, m := range mods {
+		if !slices.ContainsFunc(f.conds, func(cond func(modEntry) bool) bool { return !cond(m) }) {
+			idxs = append(idxs, i)
+		}
+	}
+
+	if f.sort != -1 {
+		slices.SortStableFunc(idxs, func(a, b int) int {
+			n := compareValues(reflect.ValueOf(mods[a]).Field(f.sort), reflect.ValueOf(mods[b]).Field(f.sort))
+			if f.desc {
+				return -n
+			}
+			return n
+		})
+	}
+
+	return idxs
+}
+
+// parseModFilter reads the arguments of list:
+//
+//	[top-level | deps-only] [where <cond> [and|or [not] <cond>...]] [sort <field> [asc|desc]]
+//	[search "name"] [id <number>] [side <side>]
+//
+// A condition is <field><op><value> with one of the ops in filterOps, or a
+// bool field on its own.
+func (c *cli) parseModFilter(tokens []token) (modFilter, error) {
+	f := modFilter{sort: -1}
+	ws := words(tokens)
+	for i := 0; i < len(ws); i++ {
+		next := func() ([]token, error) {
+			if i+1 >= len(ws) {
+				return nil, fmt.Errorf("Missing value for %s", joinTokens(ws[i]))
+			}
+			i++
+			return ws[i], nil
+		}
+
+		switch kw := joinTokens(ws[i]); kw {
+		case "top-level":
+			f.conds = append(f.conds, func(m modEntry) bool { return !c.isDep(m.Id) })
+		case "deps-only":
+			f.conds = append(f.conds, func(m modEntry) bool { return c.isDep(m.Id) })
+		case "where":
+			cond, n, err := parseWhere(ws[i+1:])
+			if err != nil {
+				return f, err
+			}
+			f.conds = append(f.conds, cond)
+			i += n
+		case "sort":
+			w, err := next()
+			if err != nil {
+				return f, err
+			}
+			if f.sort, err = fieldIndex(joinTokens(w)); err != nil {
+				return f, err
+			}
+			if i+1 < len(ws) {
+				switch joinTokens(ws[i+1]) {
+				case "asc":
+					i++
+				case "desc":
+					f.desc = true
+					i++
+				}
+			}
+		case "search":
+			w, err := next()
+			if err != nil {
+				return f, err
+			}
+			if len(w) != 1 || w[0].typ != String {
+				return f, errors.New("Invalid argument type")
+			}
+			search := w[0].parseString()
+			f.conds = append(f.conds, func(m modEntry) bool {
+				return strings.Contains(m.Name, search) || slc.FuzzyStringCompare(m.Name, search) < 0.8
+			})
+		case "id":
+			w, err := next()
+			if err != nil {
+				return f, err
+			}
+			if len(w) != 1 || w[0].typ != Number {
+				return f, errors.New("Invalid argument type")
+			}
+			search := w[0].val
+			f.conds = append(f.conds, func(m modEntry) bool { return strings.Contains(strconv.Itoa(m.Id), search) })
+		case "side":
+			w, err := next()
+			if err != nil {
+				return f, err
+			}
+			var target side
+			if err := target.UnmarshalText([]byte(joinTokens(w))); err != nil || target == sideUnknown {
+				return f, errors.New("Usage: list side <client|server|both>")
+			}
+			f.conds = append(f.conds, func(m modEntry) bool { return m.Side.runsOn(target) })
+		case "tag":
+			w, err := next()
+			if err != nil {
+				return f, err
+			}
+			tag := wordString(w)
+			f.conds = append(f.conds, func(m modEntry) bool { return m.hasTag(tag) })
+		default:
+			return f, fmt.Errorf("Unknown list option %s. Expected one of %s", kw, strings.Join(listKeywords, ", "))
+		}
+	}
+
+	return f, nil
+}
+
+// isDep reports whether another mod in the modlist requires id
+func (c *cli) isDep(id int) bool {
+	return slices.ContainsFunc(c.mods, func(m modEntry) bool { return slices.Contains(m.Deps, id) })
+}
+
+// parseWhere reads conditions joined by and/or, with and binding tighter, and
+// returns how many words it used.
+func parseWhere(ws [][]token) (func(m modEntry) bool, int, error) {
+	var groups, all []func(m modEntry) bool
+	var n int
+	for {
+		negate := n < len(ws) && joinTokens(ws[n]) == "not"
+		if negate {
+			n++
+		}
+		if n >= len(ws) {
+			return nil, n, errors.New("Missing condition. Expected <field><op><value>")
+		}
+
+		w, used := condWord(ws[n:])
+		cond, err := parseCond(w)
+		if err != nil {
+			return nil, n, err
+		}
+		if negate {
+			inner := cond
+			cond = func(m modEntry) bool { return !inner(m) }
+		}
+		all = append(all, cond)
+		n += used
+
+		if n < len(ws) {
+			switch joinTokens(ws[n]) {
+			case "and":
+				n++
+				continue
+			case "or":
+				groups = append(groups, allOf(all))
+				all = nil
+				n++
+				continue
+			}
+		}
+		break
+	}
+
+	groups = append(groups, allOf(all))
+	return func(m modEntry) bool {
+		return slices.ContainsFunc(groups, func(cond func(modEntry) bool) bool { return cond(m) })
+	}, n, nil
+}
+
+func allOf(conds []func(m modEntry) bool) func(m modEntry) bool {
+	return func(m modEntry) bool {
+		return !slices.ContainsFunc(conds, func(cond func(modEntry) bool) bool { return !cond(m) })
+	}
+}
+
+// condWord joins the words of a condition written with spaces around its
+// operator, as in loader = Fabric, and returns how many words it used.
+func condWord(ws [][]token) ([]token, int) {
+	w, n := ws[0], 1
+	if !slices.ContainsFunc(w, isOpToken) && n < len(ws) && isOpToken(ws[n][0]) {
+		w = slices.Concat(w, ws[n])
+		n++
+	}
+	if isOpToken(w[len(w)-1]) && n < len(ws) {
+		w = slices.Concat(w, ws[n])
+		n++
+	}
+	return w, n
+}
+
+func parseCond(w []token) (func(m modEntry) bool, error) {
+	k := slices.IndexFunc(w, isOpToken)
+	if k == -1 {
+		k = len(w)
+	}
+	j := k
+	for j < len(w) && isOpToken(w[j]) {
+		j++
+	}
+
+	name := joinTokens(w[:k])
+	idx, err := fieldIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	field := reflect.TypeFor[modEntry]().Field(idx)
+
+	op := joinTokens(w[k:j])
+	val := "true"
+	if k == len(w) {
+		if field.Type.Kind() != reflect.Bool {
+			return nil, fmt.Errorf("Missing comparison for %s. Expected one of %s", name, strings.Join(filterOps, " "))
+		}
+		op = "="
+	} else {
+		val = wordString(w[j:])
+	}
+
+	if !slices.Contains(filterOps, op) {
+		return nil, fmt.Errorf("Unknown operator %s. Expected one of %s", op, strings.Join(filterOps, " "))
+	}
+
+	match, err := fieldMatcher(field, op, val)
+	if err != nil {
+		return nil, err
+	}
+	return func(m modEntry) bool { return match(reflect.ValueOf(m).Field(idx)) }, nil
+}
+
+// wordString is the text of a word, unquoted if it is a string
+func wordString(w []token) string {
+	if len(w) == 1 && w[0].typ == String {
+		return w[0].parseString()
+	}
+	return joinTokens(w)
+}
+
+func isOpToken(t token) bool {
+	return t.typ == Symbol && strings.Contains("=!<>~", t.val)
+}
+
+func fieldIndex(name string) (int, error) {
+	if alias, ok := filterAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+
+	typ := reflect.TypeFor[modEntry]()
+	for i := range typ.NumField() {
+		if strings.EqualFold(jsonName(typ.Field(i)), name) {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("Unknown field %s. Expected one of %s", name, strings.Join(filterFields, ", "))
+}
+
+// fieldMatcher compares values of field against val. Lists are compared by
+// length with <, <=, > and >= and by their items with =, != and ~.
+func fieldMatcher(field reflect.StructField, op, val string) (func(v reflect.Value) bool, error) {
+	name := jsonName(field)
+	invalid := fmt.Errorf("Invalid value %q for %s", val, name)
+	onlyEq := func() error {
+		if op != "=" && op != "!=" {
+			return fmt.Errorf("Only = and != work on %s", name)
+		}
+		return nil
+	}
+
+	if field.Type == reflect.TypeFor[time.Time]() {
+		if op == "~" {
+			return nil, fmt.Errorf("~ doesn't work on %s", name)
+		}
+		t, err := parseDate(val)
+		if err != nil {
+			return nil, invalid
+		}
+		return func(v reflect.Value) bool { return opMatches(op, v.Interface().(time.Time).Compare(t)) }, nil
+	}
+
+	if reflect.PointerTo(field.Type).Implements(reflect.TypeFor[encoding.TextUnmarshaler]()) {
+		if err := onlyEq(); err != nil {
+			return nil, err
+		}
+		want := reflect.New(field.Type)
+		if err := want.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val)); err != nil {
+			return nil, invalid
+		}
+		return func(v reflect.Value) bool { return opMatches(op, cmp.Compare(v.Int(), want.Elem().Int())) }, nil
+	}
+
+	switch field.Type.Kind() {
+	case reflect.Int:
+		if op == "~" {
+			return nil, fmt.Errorf("~ doesn't work on %s", name)
+		}
+		n, err := parseFieldInt(name, val)
+		if err != nil {
+			return nil, invalid
+		}
+		return func(v reflect.Value) bool { return opMatches(op, cmp.Compare(fieldInt(name, v), n)) }, nil
+	case reflect.Bool:
+		if err := onlyEq(); err != nil {
+			return nil, err
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, invalid
+		}
+		return func(v reflect.Value) bool { return opMatches(op, cmp.Compare(boolInt(v.Bool()), boolInt(b))) }, nil
+	case reflect.String:
+		if op == "~" {
+			return func(v reflect.Value) bool { return containsFold(v.String(), val) }, nil
+		}
+		return func(v reflect.Value) bool { return opMatches(op, naturalCompare(v.String(), val)) }, nil
+	case reflect.Slice:
+		if op == "=" || op == "!=" || op == "~" {
+			return func(v reflect.Value) bool {
+				for i := range v.Len() {
+					item := fmt.Sprint(v.Index(i).Interface())
+					if (op == "~" && containsFold(item, val)) || (op != "~" && strings.EqualFold(item, val)) {
+						return op != "!="
+					}
+				}
+				return op == "!="
+			}, nil
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, invalid
+		}
+		return func(v reflect.Value) bool { return opMatches(op, cmp.Compare(v.Len(), n)) }, nil
+	}
+
+	return nil, fmt.Errorf("Can't filter by %s", name)
+}
+
+func opMatches(op string, n int) bool {
+	switch op {
+	case "=":
+		return n == 0
+	case "!=":
+		return n != 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	}
+	return false
+}
+
+func parseDate(val string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{time.DateOnly, time.RFC3339, "2006-01-02T15:04"} {
+		var t time.Time
+		if t, err = time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parseFieldInt reads a number, or a loader or class name for the fields that
+// hold one.
+func parseFieldInt(name, val string) (int, error) {
+	if n, err := strconv.Atoi(val); err == nil {
+		return n, nil
+	}
+
+	switch name {
+	case "modLoader", "fallback":
+		if idx := slices.IndexFunc(modLoaderKeywords, func(l string) bool { return strings.EqualFold(l, val) }); idx != -1 {
+			return idx, nil
+		}
+	case "class":
+		if class, ok := classByName(strings.ToLower(val)); ok {
+			return class.id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid number %s", val)
+}
+
+func fieldInt(name string, v reflect.Value) int {
+	if name == "class" {
+		return classOf(int(v.Int())).id
+	}
+	return int(v.Int())
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// compareValues orders two values of the same modEntry field. Lists are
+// ordered by length.
+func compareValues(a, b reflect.Value) int {
+	if t, ok := a.Interface().(time.Time); ok {
+		return t.Compare(b.Interface().(time.Time))
+	}
+
+	switch a.Kind() {
+	case reflect.Int:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Bool:
+		return cmp.Compare(boolInt(a.Bool()), boolInt(b.Bool()))
+	case reflect.String:
+		return naturalCompare(a.String(), b.String())
+	case reflect.Slice:
+		return cmp.Compare(a.Len(), b.Len())
+	}
+	return 0
+}
+
+// naturalCompare compares strings ignoring case and with the numbers between
+// dots compared by value, so 1.9 comes before 1.20.
+func naturalCompare(a, b string) int {
+	as := strings.Split(strings.ToLower(a), ".")
+	bs := strings.Split(strings.ToLower(b), ".")
+	for i := range min(len(as), len(bs)) {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		n := strings.Compare(as[i], bs[i])
+		if aErr == nil && bErr == nil {
+			n = cmp.Compare(an, bn)
+		}
+		if n != 0 {
+			return n
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
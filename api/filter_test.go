@@ -0,0 +1,81 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModFilter(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+	c := &cli{mods: []modEntry{
+		{Id: 1, Name: "sodium", ModLoader: loaderFabric, Uploaded: date("2023-01-10"), Deps: []int{2}},
+		{Id: 2, Name: "fabric-api", ModLoader: loaderFabric, Uploaded: date("2023-08-01")},
+		{Id: 3, Name: "jei", ModLoader: loaderForge, Uploaded: date("2022-05-01"), Deps: []int{2}, Stranded: true},
+		{Id: 4, Name: "iris", ModLoader: loaderFabric, Uploaded: date("2023-03-01"), Deps: []int{1}},
+	}}
+
+	for _, tc := range []struct {
+		name string
+		args string
+		want []int
+	}{
+		{"Example", "where loader=Fabric and uploaded<2023-06-01 and deps>0", []int{1, 4}},
+		{"Spaced operator", "where loader = Fabric and deps >0 and uploaded< 2023-06-01", []int{1, 4}},
+		{"And before or", "where loader=Forge or name=sodium and deps>0", []int{1, 3}},
+		{"Or groups", "where name=jei or name=iris and stranded", []int{3}},
+		{"Not", "where not stranded and not name~ium", []int{2, 4}},
+		{"Not or", "where not loader=Fabric or name=iris", []int{3, 4}},
+		{"Top level", "top-level", []int{3, 4}},
+		{"Deps only", "deps-only", []int{1, 2}},
+		{"Top level where", "top-level where loader=Fabric", []int{4}},
+		{"Sort", "sort uploaded", []int{3, 1, 4, 2}},
+		{"Sort desc", "where loader=Fabric sort uploaded desc", []int{2, 4, 1}},
+		{"Sort asc", "sort name asc", []int{2, 4, 3, 1}},
+	} {
+		f, err := c.parseModFilter(tokenize(tc.args))
+		if err != nil {
+			t.Errorf("%s\nUnexpected error: %s", tc.name, err)
+			continue
+		}
+
+		var got []int
+		for _, i := range f.apply(c.mods) {
+			got = append(got, c.mods[i].Id)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s\nReturned: %v\nExpected: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestModFilterErrors(t *testing.T) {
+	c := &cli{}
+	for _, tc := range []struct {
+		name string
+		args string
+		want string
+	}{
+		{"Unknown option", "newest", "Unknown list option newest"},
+		{"Unknown field", "where color=red", "Unknown field color"},
+		{"Unknown operator", "where deps=>1", "Unknown operator =>"},
+		{"Missing comparison", "where name", "Missing comparison for name"},
+		{"Missing condition", "where loader=Fabric and", "Missing condition"},
+		{"Missing not condition", "where not", "Missing condition"},
+		{"Invalid date", "where uploaded<yesterday", `Invalid value "yesterday" for uploaded`},
+		{"Invalid loader", "where loader=Spigot", `Invalid value "Spigot" for modLoader`},
+		{"Only equals", "where stranded>true", "Only = and != work on stranded"},
+		{"Contains on number", "where deps~1 and id~1", "~ doesn't work on id"},
+		{"Missing sort field", "sort", "Missing value for sort"},
+		{"Unknown sort field", "sort color", "Unknown field color"},
+	} {
+		_, err := c.parseModFilter(tokenize(tc.args))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s\nReturned: %v\nExpected: %s", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/stuff7/mcman/bitstream"
+)
+
+type fileHeader struct {
+	version int
+	count   int
+}
+
+func writeHeader(bs *bitstream.Bitstream, magic string, h fileHeader) {
+	for _, b := range []byte(magic) {
+		bs.WriteBits(int(b), 8)
+	}
+	bs.WriteBits(h.version, 8)
+	bs.WriteBits(h.count, 32)
+}
+
+// readHeader returns a version 0 header with the position left untouched when
+// the buffer doesn't start with magic.
+func readHeader(bs *bitstream.Bitstream, b *int, magic string) (fileHeader, error) {
+	var h fileHeader
+	pos := *b
+	for i := range len(magic) {
+		ch, err := bs.ReadBits(&pos, 8)
+		if err != nil || byte(ch) != magic[i] {
+			return h, nil
+		}
+	}
+
+	var err error
+	if h.version, err = bs.ReadBits(&pos, 8); err != nil {
+		return h, errors.New("Truncated header")
+	}
+	if h.count, err = bs.ReadBits(&pos, 32); err != nil {
+		return h, errors.New("Truncated header")
+	}
+
+	*b = pos
+	return h, nil
+}
+
+// migrateFile keeps a copy of a file written in an older format. The file
+// itself is rewritten in the current format on the next save.
+func migrateFile(name string, data []byte, from, to int) error {
+	backup := fmt.Sprintf("%s.v%d", name, from)
+	if err := os.WriteFile(backup, data, 0666); err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"%sMigrating %s from format v%d to v%d. The original was kept as %s%s\n",
+		clr(45), name, from, to, backup, RESET,
+	)
+	return nil
+}
+
+const backupCount = 5
+
+func backupName(name string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", name, n)
+}
+
+// saveFile moves the current contents of name into its rotating backups and
+// atomically replaces it with bs.
+func saveFile(bs *bitstream.Bitstream, name string) error {
+	curr, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err == nil {
+		if bytes.Equal(curr, bs.Bytes()) {
+			return nil
+		}
+
+		if err := rotateBackups(name, curr); err != nil {
+			return err
+		}
+	}
+
+	return bs.SaveToDisk(name)
+}
+
+func rotateBackups(name string, curr []byte) error {
+	if prev, err := os.ReadFile(backupName(name, 1)); err == nil && bytes.Equal(prev, curr) {
+		return nil
+	}
+
+	if err := os.Remove(backupName(name, backupCount)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for i := backupCount - 1; i > 0; i-- {
+		if err := os.Rename(backupName(name, i), backupName(name, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return bitstream.FromBuffer(curr).SaveToDisk(backupName(name, 1))
+}
+
+// A record is a length prefixed list of tagged fields. Each field holds its
+// own length so readers can skip tags they don't know about, which lets new
+// fields be added without bumping the format version.
+func writeRecord(bs *bitstream.Bitstream, write func(*bitstream.Bitstream)) {
+	var rec bitstream.Bitstream
+	write(&rec)
+	bs.WriteBytes(rec.Bytes())
+}
+
+func readRecord(bs *bitstream.Bitstream, b *int, read func(tag int, val *bitstream.Bitstream) error) error {
+	data, err := bs.ReadBytes(b)
+	if err != nil {
+		return err
+	}
+
+	rec := bitstream.FromBuffer(data)
+	var pos int
+	for pos < len(data)*8 {
+		tag, err := rec.ReadUvarint(&pos)
+		if err != nil {
+			return err
+		}
+
+		val, err := rec.ReadBytes(&pos)
+		if err != nil {
+			return fmt.Errorf("Field %d: %w", tag, err)
+		}
+
+		if err := read(int(tag), bitstream.FromBuffer(val)); err != nil {
+			return fmt.Errorf("Field %d: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+func writeField(bs *bitstream.Bitstream, tag int, write func(*bitstream.Bitstream)) {
+	var val bitstream.Bitstream
+	write(&val)
+	bs.WriteUvarint(uint64(tag))
+	bs.WriteBytes(val.Bytes())
+}
+
+func writeUintField(bs *bitstream.Bitstream, tag int, n int) {
+	writeField(bs, tag, func(v *bitstream.Bitstream) { v.WriteUvarint(uint64(n)) })
+}
+
+func writeIntField(bs *bitstream.Bitstream, tag int, n int64) {
+	writeField(bs, tag, func(v *bitstream.Bitstream) { v.WriteVarint(n) })
+}
+
+func writeStringField(bs *bitstream.Bitstream, tag int, s string) {
+	writeField(bs, tag, func(v *bitstream.Bitstream) { v.WriteString(s) })
+}
+
+func writeUintsField(bs *bitstream.Bitstream, tag int, ns []int) {
+	writeField(bs, tag, func(v *bitstream.Bitstream) {
+		v.WriteUvarint(uint64(len(ns)))
+		for _, n := range ns {
+			v.WriteUvarint(uint64(n))
+		}
+	})
+}
+
+func writeStringsField(bs *bitstream.Bitstream, tag int, ss []string) {
+	writeField(bs, tag, func(v *bitstream.Bitstream) {
+		v.WriteUvarint(uint64(len(ss)))
+		for _, s := range ss {
+			v.WriteString(s)
+		}
+	})
+}
+
+func readUint(val *bitstream.Bitstream) (int, error) {
+	var b int
+	n, err := val.ReadUvarint(&b)
+	return int(n), err
+}
+
+func readInt(val *bitstream.Bitstream) (int64, error) {
+	var b int
+	return val.ReadVarint(&b)
+}
+
+func readString(val *bitstream.Bitstream) (string, error) {
+	var b int
+	return val.ReadString(&b)
+}
+
+func readUints(val *bitstream.Bitstream) ([]int, error) {
+	var b int
+	n, err := val.ReadUvarint(&b)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns []int
+	for range n {
+		u, err := val.ReadUvarint(&b)
+		if err != nil {
+			return ns, err
+		}
+		ns = append(ns, int(u))
+	}
+	return ns, nil
+}
+
+func readStrings(val *bitstream.Bitstream) ([]string, error) {
+	var b int
+	n, err := val.ReadUvarint(&b)
+	if err != nil {
+		return nil, err
+	}
+
+	var ss []string
+	for range n {
+		s, err := val.ReadString(&b)
+		if err != nil {
+			return ss, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/stuff7/mcman/slc"
+)
+
+const maxHistory = 100
+
+type modChange struct {
+	idx int
+	mod modEntry
+}
+
+// modOp is a reversible change to the modlist. removed holds entries of the
+// list before the change and added entries of the list after it, each with
+// the index it had in its list. An updated entry shows up in both. query is
+// set when the change also moved the global query, like migrate does.
+type modOp struct {
+	desc    string
+	removed []modChange
+	added   []modChange
+	query   *queryChange
+}
+
+type queryChange struct {
+	from searchQuery
+	to   searchQuery
+}
+
+func diffMods(desc string, before, after []modEntry) modOp {
+	op := modOp{desc: desc}
+	for i, m := range before {
+		j := slices.IndexFunc(after, func(a modEntry) bool { return a.Id == m.Id })
+		if j == -1 || !reflect.DeepEqual(m, after[j]) {
+			op.removed = append(op.removed, modChange{i, cloneMod(m)})
+		}
+	}
+
+	for i, m := range after {
+		j := slices.IndexFunc(before, func(b modEntry) bool { return b.Id == m.Id })
+		if j == -1 || !reflect.DeepEqual(m, before[j]) {
+			op.added = append(op.added, modChange{i, cloneMod(m)})
+		}
+	}
+
+	return op
+}
+
+func (op modOp) empty() bool {
+	return len(op.removed) == 0 && len(op.added) == 0 && op.query == nil
+}
+
+func (op modOp) inverse() modOp {
+	inv := modOp{desc: op.desc, removed: op.added, added: op.removed}
+	if op.query != nil {
+		inv.query = &queryChange{from: op.query.to, to: op.query.from}
+	}
+	return inv
+}
+
+func (op modOp) apply(mods []modEntry) []modEntry {
+	mods = slices.Clone(mods)
+	for i := len(op.removed) - 1; i >= 0; i-- {
+		idx := op.removed[i].idx
+		mods = slices.Delete(mods, idx, idx+1)
+	}
+	for _, ch := range op.added {
+		mods = slices.Insert(mods, ch.idx, cloneMod(ch.mod))
+	}
+	return mods
+}
+
+func (op modOp) String() string {
+	var sb strings.Builder
+	if op.query != nil {
+		from := op.query.from.GameVersion + " " + modLoaderKeywords[op.query.from.ModLoader]
+		to := op.query.to.GameVersion + " " + modLoaderKeywords[op.query.to.ModLoader]
+		sb.WriteString(fmt.Sprintf("%s~ Query %s%s%s -> %s%s%s changed\n", clr(228), BOLD, from, RESET+clr(228), BOLD, to, RESET))
+	}
+	for _, r := range op.removed {
+		if a := slices.IndexFunc(op.added, func(a modChange) bool { return a.mod.Id == r.mod.Id }); a != -1 {
+			sb.WriteString(fmt.Sprintf("%s~ Mod %s%s%s -> %s%s%s changed\n", clr(228), BOLD, r.mod.Name, RESET+clr(228), BOLD, op.added[a].mod.Name, RESET))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s- Mod %s%s%s removed\n", clr(219), BOLD, r.mod.Name, RESET))
+		}
+	}
+
+	for _, a := range op.added {
+		if !slices.ContainsFunc(op.removed, func(r modChange) bool { return r.mod.Id == a.mod.Id }) {
+			sb.WriteString(fmt.Sprintf("%s+ Mod %s%s%s added\n", clr(49), BOLD, a.mod.Name, RESET))
+		}
+	}
+
+	return sb.String()
+}
+
+func cloneMod(m modEntry) modEntry {
+	m.Deps = slices.Clone(m.Deps)
+	m.Worlds = slices.Clone(m.Worlds)
+	m.Tags = slices.Clone(m.Tags)
+	return m
+}
+
+func cloneMods(mods []modEntry) []modEntry {
+	return slc.Map(mods, cloneMod)
+}
+
+// mutate runs fn and records whatever it changed in c.mods and c.query as one
+// undoable operation, even when fn fails halfway through.
+func (c *cli) mutate(desc string, fn func() error) error {
+	before := cloneMods(c.mods)
+	prevQuery := c.query
+	err := fn()
+
+	if op := c.diff(desc, before, prevQuery); !op.empty() {
+		c.undoOps = append(c.undoOps, op)
+		if len(c.undoOps) > maxHistory {
+			c.undoOps = c.undoOps[1:]
+		}
+		c.redoOps = nil
+		err = errors.Join(err, c.applied(op))
+	}
+
+	return err
+}
+
+// diff is the operation that took the modlist and query from before and
+// prevQuery to what they are now.
+func (c *cli) diff(desc string, before []modEntry, prevQuery searchQuery) modOp {
+	op := diffMods(desc, before, c.mods)
+	if c.query != prevQuery {
+		op.query = &queryChange{from: prevQuery, to: c.query}
+	}
+	return op
+}
+
+// apply applies op to the modlist and query
+func (c *cli) apply(op modOp) error {
+	c.mods = op.apply(c.mods)
+	if op.query != nil {
+		c.query = op.query.to
+	}
+	return c.applied(op)
+}
+
+// applied brings the instance files and the cfg in line with op once it is
+// applied.
+func (c *cli) applied(op modOp) error {
+	err := c.syncDisabled(op)
+	if op.query != nil {
+		err = errors.Join(err, c.saveCfg())
+	}
+	return err
+}
+
+// mutating wraps a command so every change it makes can be undone, or only
+// planned when it runs with --dry-run or under plan.
+func (c *cli) mutating(name string, run func(context.Context, []token) error) func(context.Context, []token) error {
+	return func(ctx context.Context, tokens []token) error {
+		desc := strings.TrimSpace(name + " " + joinTokens(tokens))
+		fn := func() error { return run(ctx, tokens) }
+
+		confirm, _ := ctx.Value(confirmKey{}).(bool)
+		if confirm || hasFlag(ctx, "dry-run") {
+			return c.plan(desc, confirm, fn)
+		}
+		return c.mutate(desc, fn)
+	}
+}
+
+// errBisecting stops undo and redo from changing which mods are disabled
+// under a running bisection.
+var errBisecting = errors.New("Can't change the history while a bisection is running. Run bisect reset first")
+
+func (c *cli) undoCmd(context.Context, []token) error {
+	if c.bisect != nil {
+		return errBisecting
+	}
+
+	op := slc.Last(c.undoOps)
+	if op == nil {
+		return errors.New("Nothing to undo")
+	}
+
+	inv := op.inverse()
+	c.undoOps = c.undoOps[:len(c.undoOps)-1]
+	c.redoOps = append(c.redoOps, *op)
+
+	fmt.Printf("Undo %s%s%s\n%s", BOLD, op.desc, RESET, inv)
+	return c.apply(inv)
+}
+
+func (c *cli) redoCmd(context.Context, []token) error {
+	if c.bisect != nil {
+		return errBisecting
+	}
+
+	op := slc.Last(c.redoOps)
+	if op == nil {
+		return errors.New("Nothing to redo")
+	}
+
+	c.redoOps = c.redoOps[:len(c.redoOps)-1]
+	c.undoOps = append(c.undoOps, *op)
+
+	fmt.Printf("Redo %s%s%s\n%s", BOLD, op.desc, RESET, *op)
+	return c.apply(*op)
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testMigrate(t *testing.T, answer string) *cli {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1/files 1.20.1": []CfFile{{ID: 11, Name: "a-1.20.jar", Release: Release, SupportedVersions: []string{"1.20.1"}}},
+	})
+
+	c := newTestCli(t, answer)
+	c.query = searchQuery{GameVersion: "1.19.4", ModLoader: loaderFabric}
+	c.mods = []modEntry{{Id: 1, FileId: 10, Name: "a-1.19.jar", GameVersion: "1.19.4", ModLoader: loaderFabric}}
+	if err := c.saveCfg(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// checkTarget checks the modlist, the query and the saved cfg all are on
+// version
+func checkTarget(t *testing.T, c *cli, step, version, file string) {
+	t.Helper()
+	d, err := os.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := decodeCfg(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.mods[0].Name != file || c.query.GameVersion != version || cfg.query.GameVersion != version {
+		t.Errorf("%s\nReturned: mod %s, query %s, cfg %s\nExpected: mod %s, query and cfg %s", step, c.mods[0].Name, c.query.GameVersion, cfg.query.GameVersion, file, version)
+	}
+}
+
+func TestPlanMigrate(t *testing.T) {
+	c := testMigrate(t, "y")
+	for _, tt := range []struct {
+		line    string
+		version string
+		file    string
+	}{
+		{"migrate 1.20.1 --dry-run", "1.19.4", "a-1.19.jar"},
+		{"plan migrate 1.20.1", "1.20.1", "a-1.20.jar"},
+		{"undo", "1.19.4", "a-1.19.jar"},
+		{"redo", "1.20.1", "a-1.20.jar"},
+	} {
+		if err := c.run(t, tt.line); err != nil {
+			t.Fatalf("%s\nerr: %s", tt.line, err)
+		}
+		checkTarget(t, c, tt.line, tt.version, tt.file)
+	}
+}
+
+func TestPlanMigrateDeclined(t *testing.T) {
+	c := testMigrate(t, "n")
+	if err := c.run(t, "plan migrate 1.20.1"); err != nil {
+		t.Fatal(err)
+	}
+	checkTarget(t, c, "plan migrate declined", "1.19.4", "a-1.19.jar")
+}
+
+func TestUndoMigrate(t *testing.T) {
+	c := testMigrate(t, "y")
+	for _, tt := range []struct {
+		line    string
+		version string
+		file    string
+	}{
+		{"migrate 1.20.1", "1.20.1", "a-1.20.jar"},
+		{"undo", "1.19.4", "a-1.19.jar"},
+	} {
+		if err := c.run(t, tt.line); err != nil {
+			t.Fatalf("%s\nerr: %s", tt.line, err)
+		}
+		checkTarget(t, c, tt.line, tt.version, tt.file)
+	}
+}
+
+// equalMods compares modlists, where nil and empty are the same
+func equalMods(a, b []modEntry) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	a := modEntry{Id: 1, FileId: 10, Name: "a.jar", Deps: []int{2}}
+	b := modEntry{Id: 2, FileId: 20, Name: "b.jar"}
+	c := modEntry{Id: 3, FileId: 30, Name: "c.jar", Tags: []string{"x"}}
+	a2 := modEntry{Id: 1, FileId: 11, Name: "a-2.jar", Deps: []int{2, 3}}
+
+	for _, tt := range []struct {
+		name   string
+		before []modEntry
+		after  []modEntry
+	}{
+		{"Add", []modEntry{a, b}, []modEntry{a, b, c}},
+		{"Add first", []modEntry{b}, []modEntry{a, b}},
+		{"Remove", []modEntry{a, b, c}, []modEntry{a, c}},
+		{"Remove all", []modEntry{a, b, c}, nil},
+		{"Update", []modEntry{a, b}, []modEntry{a2, b}},
+		{"Mixed", []modEntry{a, b}, []modEntry{c, a2}},
+		{"Nothing", []modEntry{a, b}, []modEntry{a, b}},
+	} {
+		before := cloneMods(tt.before)
+		op := diffMods(tt.name, tt.before, tt.after)
+		if op.empty() != reflect.DeepEqual(tt.before, tt.after) {
+			t.Errorf("%s\nempty: %v", tt.name, op.empty())
+		}
+
+		if got := op.apply(tt.before); !equalMods(got, tt.after) {
+			t.Errorf("%s: apply\nReturned: %+v\nExpected: %+v", tt.name, got, tt.after)
+		}
+		if got := op.inverse().apply(tt.after); !equalMods(got, tt.before) {
+			t.Errorf("%s: inverse\nReturned: %+v\nExpected: %+v", tt.name, got, tt.before)
+		}
+		if !reflect.DeepEqual(before, tt.before) {
+			t.Errorf("%s: apply changed its input\nReturned: %+v\nExpected: %+v", tt.name, tt.before, before)
+		}
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	c := newTestCli(t, "y")
+	c.mods = []modEntry{{Id: 1, Name: "a.jar"}, {Id: 2, Name: "b.jar"}}
+	for _, tt := range []struct {
+		line string
+		note string
+		mods int
+	}{
+		{`note 1 "first"`, "first", 2},
+		{`note 1 "second"`, "second", 2},
+		{"rem id 2", "second", 1},
+		{"undo", "second", 2},
+		{"undo", "first", 2},
+		{"redo", "second", 2},
+		{"redo", "second", 1},
+	} {
+		if err := c.run(t, tt.line); err != nil {
+			t.Fatalf("%s\nerr: %s", tt.line, err)
+		}
+		if c.mods[0].Note != tt.note || len(c.mods) != tt.mods {
+			t.Errorf("%s\nReturned: note %q, %d mods\nExpected: note %q, %d mods", tt.line, c.mods[0].Note, len(c.mods), tt.note, tt.mods)
+		}
+	}
+
+	if err := c.run(t, "redo"); err == nil {
+		t.Error("Expected an error with nothing left to redo")
+	}
+}
+
+func TestMigratePrune(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1/files 1.20.1": []CfFile{{ID: 12, Name: "a-1.20.jar", Release: Release, Dependencies: []Dependency{{ModId: 3, Relation: RequiredDependency}}}},
+		"/v1/mods/2/files 1.20.1": []CfFile{{ID: 22, Name: "b-1.20.jar", Release: Release}},
+		"/v1/mods/3":              cfMod{ID: 3, Name: "C", Class: classMod},
+		"/v1/mods/3/files 1.20.1": []CfFile{{ID: 32, Name: "c-1.20.jar", Release: Release}},
+		"/v1/mods/4/files 1.20.1": []CfFile{},
+	})
+	c := newTestCli(t, "y")
+	c.query = searchQuery{GameVersion: "1.19.4", ModLoader: loaderFabric}
+	c.mods = []modEntry{
+		{Id: 1, FileId: 11, Name: "a-1.19.jar", Deps: []int{2}, GameVersion: "1.19.4", ModLoader: loaderFabric},
+		{Id: 2, FileId: 21, Name: "b-1.19.jar", GameVersion: "1.19.4", ModLoader: loaderFabric},
+		{Id: 4, FileId: 41, Name: "d-1.19.jar", GameVersion: "1.19.4", ModLoader: loaderFabric},
+	}
+
+	if err := c.run(t, "migrate 1.20.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		id       int
+		name     string
+		stranded bool
+	}{
+		{1, "a-1.20.jar", false},
+		{4, "d-1.19.jar", true},
+		{3, "c-1.20.jar", false},
+	}
+	if len(c.mods) != len(want) {
+		t.Fatalf("Returned mods: %v\nExpected: 1, 4, 3", modIds(c.mods))
+	}
+	for i, w := range want {
+		if m := c.mods[i]; m.Id != w.id || m.Name != w.name || m.Stranded != w.stranded {
+			t.Errorf("Entry %d\nReturned: %d %s stranded %v\nExpected: %d %s stranded %v", i, m.Id, m.Name, m.Stranded, w.id, w.name, w.stranded)
+		}
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1/files 1.20.1": []CfFile{{ID: 12, Name: "a-1.20.jar", Release: Release, Dependencies: []Dependency{{ModId: 3, Relation: RequiredDependency}}}},
+	})
+	c := newTestCli(t, "y")
+	c.query = searchQuery{GameVersion: "1.19.4", ModLoader: loaderFabric}
+	c.mods = []modEntry{{Id: 1, FileId: 11, Name: "a-1.19.jar", GameVersion: "1.19.4", ModLoader: loaderFabric}}
+	before := cloneMods(c.mods)
+
+	if err := c.run(t, "migrate 1.20.1"); err == nil {
+		t.Fatal("Expected the missing dependency to fail the migration")
+	}
+	if !equalMods(c.mods, before) || c.query.GameVersion != "1.19.4" || len(c.undoOps) != 0 {
+		t.Errorf("Returned: mods %+v, query %s, %d undo operations\nExpected the modlist and query untouched", c.mods, c.query, len(c.undoOps))
+	}
+}
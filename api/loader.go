@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// loaderMeta is the meta server Fabric style loaders publish their versions
+// and launcher profiles on.
+type loaderMeta struct {
+	loader int
+	url    string
+	api    string
+}
+
+var loaderMetas = []loaderMeta{
+	{loaderFabric, "https://meta.fabricmc.net", "/v2"},
+	{loaderQuilt, "https://meta.quiltmc.org", "/v3"},
+}
+
+type loaderVersion struct {
+	Loader struct {
+		Version string `json:"version"`
+		Stable  *bool  `json:"stable"`
+	} `json:"loader"`
+}
+
+// stable reports whether v is a stable release. Quilt doesn't say, but its
+// prereleases carry a suffix like -beta.1.
+func (v loaderVersion) stable() bool {
+	if v.Loader.Stable != nil {
+		return *v.Loader.Stable
+	}
+	return !strings.Contains(v.Loader.Version, "-")
+}
+
+// loaderMeta returns the meta server of the current loader, or of the
+// configured stand-in when there is one.
+func (c *cli) loaderMeta() (string, error) {
+	idx := slices.IndexFunc(loaderMetas, func(m loaderMeta) bool { return m.loader == c.query.ModLoader })
+	if idx == -1 {
+		return "", fmt.Errorf("Only Fabric and Quilt can be installed, the current loader is %s", modLoaderKeywords[c.query.ModLoader])
+	}
+
+	meta := loaderMetas[idx]
+	if c.metaURL != "" {
+		return strings.TrimRight(c.metaURL, "/") + meta.api, nil
+	}
+	return meta.url + meta.api, nil
+}
+
+func getMeta(ctx context.Context, metaURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metaURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := dlClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("Bad Response %s from %s", res.Status, metaURL)
+	}
+
+	return body, nil
+}
+
+// loaderVersions lists the loader versions available for the current game
+// version, newest first.
+func (c *cli) loaderVersions(ctx context.Context) ([]loaderVersion, error) {
+	base, err := c.loaderMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := getMeta(ctx, fmt.Sprintf("%s/versions/loader/%s", base, url.PathEscape(c.query.GameVersion)))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []loaderVersion
+	if err := json.Unmarshal(body, &versions); err != nil {
+		return nil, dumpJson(body, err)
+	}
+	return versions, nil
+}
+
+// installLoader writes the launcher profile of a loader version into the
+// versions directory of the instance and returns its id.
+func (c *cli) installLoader(ctx context.Context, version string) (string, error) {
+	base, err := c.loaderMeta()
+	if err != nil {
+		return "", err
+	}
+
+	body, err := getMeta(ctx, fmt.Sprintf("%s/versions/loader/%s/%s/profile/json", base, url.PathEscape(c.query.GameVersion), url.PathEscape(version)))
+	if err != nil {
+		return "", err
+	}
+
+	var profile struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &profile); err != nil {
+		return "", dumpJson(body, err)
+	}
+	if !validDirName(profile.ID) {
+		return "", fmt.Errorf("Invalid profile id %q", profile.ID)
+	}
+
+	dir := filepath.Join(c.instanceDir(), "versions", profile.ID)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+
+	return profile.ID, os.WriteFile(filepath.Join(dir, profile.ID+".json"), body, 0666)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stuff7/mcman/cache"
+)
+
+func TestLoaderMeta(t *testing.T) {
+	const profile = `{"id":"fabric-loader-0.15.0-1.20.1","inheritsFrom":"1.20.1"}`
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch r.URL.Path {
+		case "/v2/versions/loader/1.20.1":
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"loader": map[string]any{"version": "0.16.0-beta.1", "stable": false}},
+				{"loader": map[string]any{"version": "0.15.0", "stable": true}},
+			})
+		case "/v2/versions/loader/1.20.1/0.15.0/profile/json":
+			w.Write([]byte(profile))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCli(t, "")
+	c.query = searchQuery{GameVersion: "1.20.1", ModLoader: loaderFabric}
+	for _, line := range []string{`set meta "` + srv.URL + `"`, "loader versions", "loader install"} {
+		if err := c.run(t, line); err != nil {
+			t.Fatalf("%s\nerr: %s", line, err)
+		}
+	}
+
+	expected := []string{
+		"/v2/versions/loader/1.20.1",
+		"/v2/versions/loader/1.20.1",
+		"/v2/versions/loader/1.20.1/0.15.0/profile/json",
+	}
+	if !slices.Equal(paths, expected) {
+		t.Errorf("Requests mismatch\nReturned: %v\nExpected: %v", paths, expected)
+	}
+
+	ret, err := os.ReadFile(filepath.Join("versions", "fabric-loader-0.15.0-1.20.1", "fabric-loader-0.15.0-1.20.1.json"))
+	if err != nil || string(ret) != profile {
+		t.Errorf("Profile mismatch\nReturned: %s\nExpected: %s\nerr: %v", ret, profile, err)
+	}
+
+	d, err := os.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := decodeCfg(d)
+	if err != nil || cfg.loaderVersion != "0.15.0" || cfg.metaURL != srv.URL {
+		t.Errorf("Saved cfg mismatch\nReturned: %#+v %#+v\nExpected: 0.15.0 %#+v\nerr: %v", cfg.loaderVersion, cfg.metaURL, srv.URL, err)
+	}
+
+	if err := c.run(t, "loader install 0.17.0"); err == nil {
+		t.Errorf("Installing a missing version should fail")
+	}
+}
+
+func TestLoaderOffline(t *testing.T) {
+	c := newTestCli(t, "")
+	c.query = searchQuery{GameVersion: "1.20.1", ModLoader: loaderFabric}
+	c.offline = true
+
+	if err := c.run(t, "loader versions"); !isOffline(err) {
+		t.Errorf("loader versions offline\nReturned: %v\nExpected: %v", err, cache.ErrOffline)
+	}
+	if err := c.run(t, "loader install"); err != nil {
+		t.Errorf("loader install offline should be queued\nerr: %s", err)
+	}
+	if queue, err := readQueue(); err != nil || !slices.Equal(queue, []string{"loader install"}) {
+		t.Errorf("Queue mismatch\nReturned: %#+v\nExpected: %#+v\nerr: %v", queue, []string{"loader install"}, err)
+	}
+}
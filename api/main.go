@@ -1,20 +1,24 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/stuff7/mcman/htmlterm"
 	"github.com/stuff7/mcman/slc"
 )
 
-func (c *cli) importMods(path string) error {
+func (c *cli) importMods(ctx context.Context, path string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -32,10 +36,13 @@ func (c *cli) importMods(path string) error {
 	}
 
 	for _, mod := range mods {
-		if err := c.addMod(mod.ID, false); err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := c.addMod(ctx, mod.ID, false); err != nil {
 			fmt.Printf("%s! %s%s%s\n", clr(210), BOLD, err, RESET)
 		}
-		time.Sleep(time.Millisecond * 100)
 	}
 
 	return nil
@@ -64,33 +71,64 @@ func (c *cli) remMod(search any, isIdx bool) error {
 		return errors.New("Invalid search")
 	}
 
-	return removeModEntry(&c.mods, idx)
+	removed, err := removeModEntry(&c.mods, idx)
+	for i, m := range removed {
+		if i == 0 {
+			c.logf("%s- Mod %s%s%s removed\n", clr(219), BOLD, m.Name, RESET)
+		} else {
+			c.logf("%s- Dep %s%s%s removed\n", clr(216), BOLD, m.Name, RESET)
+		}
+	}
+
+	return err
 }
 
-func (c *cli) addMod(search any, isDependency bool) error {
-	var id int
+func (c *cli) addMod(ctx context.Context, search any, isDependency bool) error {
+	var id, loader, class int
 	var f *CfFile
 	switch search := search.(type) {
 	case string:
-		mods, err := searchMods(search, c.query)
-		if err != nil {
-			return err
+		var m *cfMod
+		for _, q := range c.fallbackQueries(c.query) {
+			mods, _, err := searchMods(ctx, newSearchOptions(search), q)
+			if isOffline(err) {
+				return c.enqueue("add search " + strconv.Quote(search))
+			}
+			if err != nil {
+				return err
+			}
+
+			if m = slc.Get(mods, 0); m != nil {
+				loader = q.ModLoader
+				break
+			}
 		}
 
-		m := slc.Get(mods, 0)
 		if m == nil {
 			return errors.New("No mods found")
 		}
 
-		id = m.ID
+		id, class = m.ID, m.Class
 		f = slc.Last(m.Files)
 	case int:
-		m, err := getModFiles(search, c.query)
+		mod, err := getMod(ctx, search)
+		if isOffline(err) {
+			return c.enqueue(fmt.Sprintf("add id %d", search))
+		}
+		if err != nil {
+			return err
+		}
+
+		query := modEntry{Class: mod.Class}.target(c.query)
+		m, err := c.getModFilesFallback(ctx, search, query)
+		if isOffline(err) {
+			return c.enqueue(fmt.Sprintf("add id %d", search))
+		}
 		if err != nil {
 			return err
 		}
 
-		id = m.ID
+		id, loader, class = m.ID, m.ModLoader, mod.Class
 		f = slc.Get(m.Files, 0)
 	}
 
@@ -98,55 +136,316 @@ func (c *cli) addMod(search any, isDependency bool) error {
 		return fmt.Errorf("No downloads found for %+v", search)
 	}
 
-	c.mods = appendModEntry(c.mods, id, c.query, f)
+	entry := modEntry{Id: id, Class: class}
+	query := entry.target(c.query)
+	entry.ModLoader, entry.GameVersion = query.ModLoader, query.GameVersion
+	c.mods = appendModEntry(c.mods, entry, loader, f)
+	c.warnGuessedURL(ctx, f)
 	if isDependency {
-		fmt.Printf("%s+ Dep %s%s%s added\n", clr(51), BOLD, f.Name, RESET)
+		c.logf("%s+ Dep %s%s%s added\n", clr(51), BOLD, f.Name, RESET)
 	} else {
-		fmt.Printf("%s+ Mod %s%s%s added\n", clr(49), BOLD, f.Name, RESET)
+		c.logf("%s+ Mod %s%s%s added\n", clr(49), BOLD, f.Name, RESET)
 	}
 	for _, d := range f.Dependencies {
 		if d.Relation == RequiredDependency && !slices.ContainsFunc(c.mods, func(m modEntry) bool { return d.ModId == m.Id }) {
-			return c.addMod(d.ModId, true)
+			return c.addMod(ctx, d.ModId, true)
+		}
+	}
+
+	return nil
+}
+
+type modUpdate struct {
+	idx    int
+	file   CfFile
+	loader int
+	// changes are the files after the installed one up to file, newest first
+	changes []CfFile
+}
+
+// findUpdates looks for a newer file of every mod in ids, or of every mod when
+// ids is empty, using the query each mod was added with.
+func (c *cli) findUpdates(ctx context.Context, ids []int) ([]modUpdate, error) {
+	var updates []modUpdate
+	for i, m := range c.mods {
+		if len(ids) != 0 && !slices.Contains(ids, m.Id) {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return updates, err
+		}
+
+		files, err := c.getModFilesFallback(ctx, m.Id, searchQuery{GameVersion: m.GameVersion, ModLoader: m.ModLoader})
+		if err != nil {
+			return updates, err
+		}
+
+		f := latestFile(files.Files)
+		if f != nil && f.ID != m.FileId && f.Uploaded.After(m.Uploaded) {
+			updates = append(updates, modUpdate{i, *f, files.ModLoader, filesBetween(files.Files, m.Uploaded, f.Uploaded)})
+		}
+	}
+
+	return updates, nil
+}
+
+func (c *cli) applyUpdate(ctx context.Context, u modUpdate) error {
+	m := &c.mods[u.idx]
+	old := m.Name
+	m.setFile(&u.file)
+	m.setLoader(u.loader)
+	c.warnGuessedURL(ctx, &u.file)
+	c.logf("%s^ Mod %s%s%s -> %s%s%s updated\n", clr(228), BOLD, old, RESET+clr(228), BOLD, u.file.Name, RESET)
+
+	for _, d := range requiredDeps(&u.file) {
+		if !slices.ContainsFunc(c.mods, func(m modEntry) bool { return m.Id == d }) {
+			if err := c.addMod(ctx, d, true); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func getVersions() ([]gameVersion, error) {
+// filesBetween returns the files uploaded after from up to and including to,
+// newest first.
+func filesBetween(files []CfFile, from, to time.Time) []CfFile {
+	var between []CfFile
+	for _, f := range files {
+		if f.Uploaded.After(from) && !f.Uploaded.After(to) {
+			between = append(between, f)
+		}
+	}
+	slices.SortFunc(between, func(a, b CfFile) int { return b.Uploaded.Compare(a.Uploaded) })
+	return between
+}
+
+func latestFile(files []CfFile) *CfFile {
+	var latest *CfFile
+	for i := range files {
+		if latest == nil || files[i].Uploaded.After(latest.Uploaded) {
+			latest = &files[i]
+		}
+	}
+	return latest
+}
+
+type compatStatus int
+
+const (
+	compatAvailable compatStatus = iota
+	compatUnstable
+	compatMissing
+)
+
+var compatKeywords = []string{"available", "unstable", "missing"}
+
+// modCompat is the file a mod would resolve to at another target. file is nil
+// when the mod is missing there, or when looking it up failed with err.
+type modCompat struct {
+	idx    int
+	status compatStatus
+	file   *CfFile
+	loader int
+	err    error
+}
+
+// checkCompat looks up the best file of every mod for query, preferring
+// releases over betas and alphas. Mods whose lookup fails count as missing so
+// one removed project doesn't stop the rest from being checked.
+func (c *cli) checkCompat(ctx context.Context, query searchQuery) ([]modCompat, error) {
+	var compat []modCompat
+	for i, m := range c.mods {
+		if err := ctx.Err(); err != nil {
+			return compat, err
+		}
+
+		files, err := c.getModFilesFallback(ctx, m.Id, m.target(query))
+		if err != nil {
+			if ctx.Err() != nil || isOffline(err) {
+				return compat, err
+			}
+			compat = append(compat, modCompat{idx: i, status: compatMissing, err: err})
+			continue
+		}
+
+		mc := modCompat{idx: i, status: compatMissing, loader: files.ModLoader}
+		releases := slc.Filter(files.Files, func(f CfFile) bool { return f.Release == Release })
+		if f := latestFile(releases); f != nil {
+			mc.status, mc.file = compatAvailable, f
+		} else if f := latestFile(files.Files); f != nil {
+			mc.status, mc.file = compatUnstable, f
+		}
+		compat = append(compat, mc)
+	}
+
+	return compat, nil
+}
+
+// migrateMods retargets every mod to query along with the dependencies of
+// their new files. Mods without a file there are kept as stranded and
+// dependencies nothing needs anymore are dropped. On failure c.mods is left
+// untouched.
+func (c *cli) migrateMods(ctx context.Context, query searchQuery) error {
+	compat, err := c.checkCompat(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	before := c.mods
+	wereDeps := slc.Flatten(slc.Map(before, func(m modEntry) []int { return m.Deps }))
+	c.mods = cloneMods(before)
+
+	for _, mc := range compat {
+		m := &c.mods[mc.idx]
+		if mc.file == nil {
+			if mc.err != nil {
+				c.logf("%s! Could not look up %s%s%s%s: %s%s\n", clr(227), BOLD, m.Name, RESET, clr(227), mc.err, RESET)
+			}
+			m.Stranded = true
+			continue
+		}
+
+		old := m.Name
+		target := m.target(query)
+		m.ModLoader, m.GameVersion, m.Stranded = target.ModLoader, target.GameVersion, false
+		m.setFile(mc.file)
+		m.setLoader(mc.loader)
+		c.warnGuessedURL(ctx, mc.file)
+		c.logf("%s^ Mod %s%s%s -> %s%s%s migrated\n", clr(228), BOLD, old, RESET+clr(228), BOLD, m.Name, RESET)
+	}
+
+	prevQuery := c.query
+	c.query = query
+	defer func() { c.query = prevQuery }()
+
+	for i := 0; i < len(c.mods); i++ {
+		for _, d := range c.mods[i].Deps {
+			if slices.ContainsFunc(c.mods, func(m modEntry) bool { return m.Id == d }) {
+				continue
+			}
+			if err := c.addMod(ctx, d, true); err != nil {
+				c.mods = before
+				return err
+			}
+		}
+	}
+
+	for pruned := true; pruned; {
+		pruned = false
+		needed := slc.Flatten(slc.Map(c.mods, func(m modEntry) []int { return m.Deps }))
+		c.mods = slc.Filter(c.mods, func(m modEntry) bool {
+			if !slices.Contains(wereDeps, m.Id) || slices.Contains(needed, m.Id) {
+				return true
+			}
+			c.logf("%s- Dep %s%s%s no longer needed\n", clr(216), BOLD, m.Name, RESET)
+			pruned = true
+			return false
+		})
+	}
+
+	if stranded := slc.Filter(c.mods, func(m modEntry) bool { return m.Stranded }); len(stranded) != 0 {
+		c.logf("%s%d mods have no file for %s %s and are stranded:%s\n", clr(219), len(stranded), query.GameVersion, modLoaderKeywords[query.ModLoader], RESET)
+		for _, m := range stranded {
+			c.logf("  %s%s%s\n", BOLD, m.Name, RESET)
+		}
+	}
+
+	return nil
+}
+
+func getVersions(ctx context.Context) ([]gameVersion, error) {
 	var versions []gameVersion
-	if err := getJSON(&versions, "/v1/minecraft/version"); err != nil {
+	if err := getJSON(ctx, &versions, "/v1/minecraft/version"); err != nil {
 		return versions, err
 	}
 
 	return versions, nil
 }
 
-func searchMods(search string, query searchQuery) ([]cfMod, error) {
-	var mods []cfMod
-	if err := getJSON(
-		&mods,
+func searchMods(ctx context.Context, opts searchOptions, query searchQuery) ([]cfMod, cfPagination, error) {
+	query = modEntry{Class: opts.Class}.target(query)
+	var res CfResponse[[]cfMod]
+	if err := getResponse(
+		ctx,
+		&res,
 		fmt.Sprintf(
-			"/v1/mods/search%s&gameId=%d&searchFilter=%s&sortField=2&sortOrder=desc",
+			"/v1/mods/search%s&gameId=%d%s",
 			query,
 			MINECRAFT_ID,
-			search,
+			opts,
 		),
 	); err != nil {
-		return mods, err
+		return res.Data, res.Pagination, err
+	}
+	return res.Data, res.Pagination, nil
+}
+
+func getMod(ctx context.Context, id int) (cfMod, error) {
+	var mod cfMod
+	if err := getJSON(ctx, &mod, fmt.Sprintf("/v1/mods/%d", id)); err != nil {
+		return mod, err
 	}
-	return mods, nil
+
+	return mod, nil
 }
 
-func getModFiles(id int, query searchQuery) (ModFiles, error) {
+// getChangelog returns the changelog of a file rendered for the terminal,
+// wrapped at width.
+func getChangelog(ctx context.Context, id, fileId, width int) (string, error) {
+	var changelog string
+	if err := getJSON(ctx, &changelog, fmt.Sprintf("/v1/mods/%d/files/%d/changelog", id, fileId)); err != nil {
+		return "", err
+	}
+
+	return htmlterm.Render(changelog, width), nil
+}
+
+// getDescription returns the HTML description of a mod
+func getDescription(ctx context.Context, id int) (string, error) {
+	var description string
+	if err := getJSON(ctx, &description, fmt.Sprintf("/v1/mods/%d/description", id)); err != nil {
+		return "", err
+	}
+
+	return description, nil
+}
+
+func getModFiles(ctx context.Context, id int, query searchQuery) (ModFiles, error) {
 	ret := ModFiles{ID: id, GameVersion: query.GameVersion, ModLoader: query.ModLoader}
-	if err := getJSON(&ret.Files, fmt.Sprintf("/v1/mods/%d/files%s", id, query)); err != nil {
+	if err := getJSON(ctx, &ret.Files, fmt.Sprintf("/v1/mods/%d/files%s", id, query)); err != nil {
 		return ret, err
 	}
 
 	return ret, nil
 }
 
+// fallbackQueries returns query followed by the same query for every loader
+// in its fallback chain.
+func (c *cli) fallbackQueries(query searchQuery) []searchQuery {
+	queries := []searchQuery{query}
+	for _, l := range c.fallbacks[query.ModLoader] {
+		queries = append(queries, searchQuery{GameVersion: query.GameVersion, ModLoader: l})
+	}
+	return queries
+}
+
+// getModFilesFallback returns the files of the first loader in the fallback
+// chain of query that has any.
+func (c *cli) getModFilesFallback(ctx context.Context, id int, query searchQuery) (ModFiles, error) {
+	var files ModFiles
+	for _, q := range c.fallbackQueries(query) {
+		var err error
+		if files, err = getModFiles(ctx, id, q); err != nil || len(files.Files) != 0 {
+			return files, err
+		}
+	}
+	files.ModLoader = query.ModLoader
+	return files, nil
+}
+
 func clr(id byte) string {
 	return fmt.Sprintf("\x1b[38;5;%dm", id)
 }
@@ -164,6 +463,76 @@ type searchQuery struct {
 }
 
 var queryFields = (searchQuery{}).getFields()
+var settingFields = slices.Concat(queryFields, []string{"offline", "autosave", "fallback", "instance", "meta"})
+
+var searchKeywords = []string{"page", "sort", "order", "category", "class", "size", "tag"}
+
+var sortFieldKeywords = []string{
+	"",
+	"featured",
+	"popularity",
+	"updated",
+	"name",
+	"author",
+	"downloads",
+}
+
+var sortOrderKeywords = []string{"asc", "desc"}
+
+const maxPageSize = 50
+const maxSearchResults = 10000
+
+type searchOptions struct {
+	Filter    string
+	Page      int
+	PageSize  int
+	SortField int
+	SortOrder string
+	Category  int
+	Class     int
+	// Tag keeps only the results in the modlist with this tag
+	Tag string
+}
+
+func newSearchOptions(filter string) searchOptions {
+	return searchOptions{
+		Filter:    filter,
+		Page:      1,
+		PageSize:  maxPageSize,
+		SortField: slices.Index(sortFieldKeywords, "popularity"),
+		SortOrder: "desc",
+		Class:     classMod,
+	}
+}
+
+func (o searchOptions) String() string {
+	var query strings.Builder
+	query.WriteString(fmt.Sprintf(
+		"&searchFilter=%s&sortField=%d&sortOrder=%s&index=%d&pageSize=%d",
+		url.QueryEscape(o.Filter),
+		o.SortField,
+		o.SortOrder,
+		(o.Page-1)*o.PageSize,
+		o.PageSize,
+	))
+
+	if o.Category != 0 {
+		query.WriteString(fmt.Sprintf("&categoryId=%d", o.Category))
+	}
+
+	if o.Class != 0 {
+		query.WriteString(fmt.Sprintf("&classId=%d", o.Class))
+	}
+
+	return query.String()
+}
+
+func (p cfPagination) pages() int {
+	if p.PageSize == 0 {
+		return 0
+	}
+	return (p.TotalCount + p.PageSize - 1) / p.PageSize
+}
 
 func (q searchQuery) String() string {
 	t := reflect.TypeOf(q)
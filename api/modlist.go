@@ -0,0 +1,289 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/stuff7/mcman/bitstream"
+)
+
+const modlistFile = "modlist"
+const modlistMagic = "MCML"
+
+// Format versions of the modlist file. Version 0 is the original headerless
+// layout, every later version starts with a header.
+const (
+	modlistV0 = iota
+	modlistV1
+	modlistV2
+)
+
+const modlistVersion = modlistV2
+
+// Field tags of a modlist v2 entry
+const (
+	entryId = iota + 1
+	entryFileId
+	entryModLoader
+	entryGameVersion
+	entryName
+	entryDeps
+	entryUploaded
+	entryDownloadUrl
+	entryStranded
+	entryFallback
+	entrySide
+	entryClass
+	entryWorlds
+	entryTags
+	entryNote
+	entryDisabled
+)
+
+const downloadURL = "https://edge.forgecdn.net/files/"
+
+func (c *cli) readMods() error {
+	if c.mods != nil {
+		return errors.New("Mods already loaded")
+	}
+
+	d, err := os.ReadFile(modlistFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	mods, version, err := decodeMods(d)
+	if err != nil {
+		return err
+	}
+
+	if version != modlistVersion {
+		if err := migrateFile(modlistFile, d, version, modlistVersion); err != nil {
+			return err
+		}
+	}
+
+	c.mods = mods
+	c.saved = cloneMods(mods)
+	return nil
+}
+
+func decodeMods(d []byte) ([]modEntry, int, error) {
+	bs := bitstream.FromBuffer(d)
+	b := 0
+	h, err := readHeader(bs, &b, modlistMagic)
+	if err != nil {
+		return nil, h.version, fmt.Errorf("Corrupt %s file: %w", modlistFile, err)
+	}
+
+	var mods []modEntry
+	switch h.version {
+	case modlistV0:
+		for b < len(d)*8 {
+			m, err := readModEntryV0(bs, &b)
+			if err != nil {
+				return nil, h.version, fmt.Errorf("Corrupt %s file at entry %d: %w", modlistFile, len(mods), err)
+			}
+			mods = append(mods, m)
+		}
+	case modlistV1, modlistV2:
+		readEntry := readModEntry
+		if h.version == modlistV1 {
+			readEntry = readModEntryV0
+		}
+
+		for i := range h.count {
+			m, err := readEntry(bs, &b)
+			if err != nil {
+				return nil, h.version, fmt.Errorf("Corrupt %s file at entry %d of %d: %w", modlistFile, i, h.count, err)
+			}
+			mods = append(mods, m)
+		}
+		if b != len(d)*8 {
+			return nil, h.version, fmt.Errorf("Corrupt %s file: %d unexpected trailing bytes", modlistFile, len(d)-b/8)
+		}
+	default:
+		return nil, h.version, fmt.Errorf("Unknown %s format version %d. This version of mcman supports up to %d", modlistFile, h.version, modlistVersion)
+	}
+
+	return mods, h.version, nil
+}
+
+func (c *cli) saveMods() error {
+	var bs bitstream.Bitstream
+	writeHeader(&bs, modlistMagic, fileHeader{version: modlistVersion, count: len(c.mods)})
+	for _, m := range c.mods {
+		writeModEntry(&bs, m)
+	}
+
+	if err := saveFile(&bs, modlistFile); err != nil {
+		return err
+	}
+
+	c.saved = cloneMods(c.mods)
+	return nil
+}
+
+// dirty reports whether the modlist has changed since it was last loaded or
+// saved.
+func (c *cli) dirty() bool {
+	return !slices.EqualFunc(c.mods, c.saved, func(a, b modEntry) bool { return reflect.DeepEqual(a, b) })
+}
+
+func fileURL(fileId int, name string) string {
+	return fmt.Sprintf("%s%d/%d/%s", downloadURL, fileId/1000, fileId%1000, url.QueryEscape(name))
+}
+
+func writeModEntry(bs *bitstream.Bitstream, m modEntry) {
+	writeRecord(bs, func(rec *bitstream.Bitstream) {
+		writeUintField(rec, entryId, m.Id)
+		writeUintField(rec, entryFileId, m.FileId)
+		writeUintField(rec, entryModLoader, m.ModLoader)
+		writeStringField(rec, entryGameVersion, m.GameVersion)
+		writeStringField(rec, entryName, m.Name)
+		if len(m.Deps) != 0 {
+			writeUintsField(rec, entryDeps, m.Deps)
+		}
+		writeIntField(rec, entryUploaded, m.Uploaded.Unix())
+		if m.DownloadUrl != fileURL(m.FileId, m.Name) {
+			writeStringField(rec, entryDownloadUrl, m.DownloadUrl)
+		}
+		if m.Stranded {
+			writeUintField(rec, entryStranded, 1)
+		}
+		if m.Fallback != 0 {
+			writeUintField(rec, entryFallback, m.Fallback)
+		}
+		if m.Side != sideUnknown {
+			writeUintField(rec, entrySide, int(m.Side))
+		}
+		if m.Class != 0 {
+			writeUintField(rec, entryClass, m.Class)
+		}
+		if len(m.Worlds) != 0 {
+			writeStringsField(rec, entryWorlds, m.Worlds)
+		}
+		if len(m.Tags) != 0 {
+			writeStringsField(rec, entryTags, m.Tags)
+		}
+		if m.Note != "" {
+			writeStringField(rec, entryNote, m.Note)
+		}
+		if m.Disabled {
+			writeUintField(rec, entryDisabled, 1)
+		}
+	})
+}
+
+func readModEntry(bs *bitstream.Bitstream, b *int) (modEntry, error) {
+	var m modEntry
+	err := readRecord(bs, b, func(tag int, val *bitstream.Bitstream) error {
+		var err error
+		switch tag {
+		case entryId:
+			m.Id, err = readUint(val)
+		case entryFileId:
+			m.FileId, err = readUint(val)
+		case entryModLoader:
+			m.ModLoader, err = readUint(val)
+		case entryGameVersion:
+			m.GameVersion, err = readString(val)
+		case entryName:
+			m.Name, err = readString(val)
+		case entryDeps:
+			m.Deps, err = readUints(val)
+		case entryUploaded:
+			var uploaded int64
+			uploaded, err = readInt(val)
+			m.Uploaded = time.Unix(uploaded, 0).UTC()
+		case entryDownloadUrl:
+			m.DownloadUrl, err = readString(val)
+		case entryStranded:
+			var stranded int
+			stranded, err = readUint(val)
+			m.Stranded = stranded != 0
+		case entryFallback:
+			m.Fallback, err = readUint(val)
+		case entrySide:
+			var s int
+			s, err = readUint(val)
+			m.Side = side(s)
+		case entryClass:
+			m.Class, err = readUint(val)
+		case entryWorlds:
+			m.Worlds, err = readStrings(val)
+		case entryTags:
+			m.Tags, err = readStrings(val)
+		case entryNote:
+			m.Note, err = readString(val)
+		case entryDisabled:
+			var disabled int
+			disabled, err = readUint(val)
+			m.Disabled = disabled != 0
+		}
+		return err
+	})
+
+	if m.DownloadUrl == "" {
+		m.DownloadUrl = fileURL(m.FileId, m.Name)
+	}
+
+	return m, err
+}
+
+func readModEntryV0(bs *bitstream.Bitstream, b *int) (modEntry, error) {
+	var m modEntry
+	var err error
+	m.Id, err = bs.ReadBits(b, 24)
+	if err != nil {
+		return m, err
+	}
+
+	if err := readQueryV0(bs, b, &m.ModLoader, &m.GameVersion); err != nil {
+		return m, err
+	}
+
+	id1, err := bs.ReadBits(b, 14)
+	if err != nil {
+		return m, err
+	}
+	id2, err := bs.ReadBits(b, 10)
+	if err != nil {
+		return m, err
+	}
+
+	depsLen, err := bs.ReadBits(b, 4)
+	if err != nil {
+		return m, err
+	}
+	for i := 0; i < depsLen; i++ {
+		dep, err := bs.ReadBits(b, 24)
+		if err != nil {
+			return m, err
+		}
+		m.Deps = append(m.Deps, dep)
+	}
+
+	m.Name, err = bs.ReadPascalString(b)
+	if err != nil {
+		return m, err
+	}
+	m.FileId = id1*1000 + id2
+	m.DownloadUrl = fileURL(m.FileId, m.Name)
+
+	uploaded, err := bs.ReadBits64(b, 64)
+	if err != nil {
+		return m, err
+	}
+
+	m.Uploaded = time.Unix(uploaded, 0).UTC()
+	return m, nil
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuff7/mcman/bitstream"
+)
+
+// writeModsV0 encodes mods the way the headerless modlist was written, with
+// the game version as 1.<major>.<minor>.
+func writeModsV0(t *testing.T, bs *bitstream.Bitstream, mods []modEntry) {
+	for _, m := range mods {
+		bs.WriteBits(m.Id, 24)
+		bs.WriteBits(m.ModLoader, 3)
+		var major, minor int
+		for i, part := range strings.Split(strings.TrimPrefix(m.GameVersion, "1."), ".") {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				major = n
+			} else {
+				minor = n
+			}
+		}
+		bs.WriteBits(major, 5)
+		bs.WriteBits(minor, 4)
+		bs.WriteBits(m.FileId/1000, 14)
+		bs.WriteBits(m.FileId%1000, 10)
+		bs.WriteBits(len(m.Deps), 4)
+		for _, dep := range m.Deps {
+			bs.WriteBits(dep, 24)
+		}
+		if err := bs.WritePascalString(m.Name); err != nil {
+			t.Fatal(err)
+		}
+		bs.WriteBits64(m.Uploaded.Unix(), 64)
+	}
+}
+
+var legacyMods = []modEntry{
+	{Id: 394468, FileId: 4585013, ModLoader: loaderFabric, GameVersion: "1.20.1", Name: "sodium-fabric-mc1.20.1-0.5.0.jar", Deps: []int{306612, 1}, Uploaded: time.Unix(1686000000, 0).UTC()},
+	{Id: 238222, FileId: 4712868, ModLoader: loaderForge, GameVersion: "1.20", Name: "jei 1.20+forge.jar", Uploaded: time.Unix(1690000000, 0).UTC()},
+}
+
+func TestReadLegacyModlist(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		version int
+	}{
+		{"V0", modlistV0},
+		{"V1", modlistV1},
+	} {
+		c := newTestCli(t, "y")
+		var bs bitstream.Bitstream
+		if tt.version != modlistV0 {
+			writeHeader(&bs, modlistMagic, fileHeader{version: tt.version, count: len(legacyMods)})
+		}
+		writeModsV0(t, &bs, legacyMods)
+		if err := os.WriteFile(modlistFile, bs.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.readMods(); err != nil {
+			t.Fatalf("%s\nerr: %s", tt.name, err)
+		}
+		checkLegacyMods(t, tt.name, c.mods)
+
+		backup, err := os.ReadFile(fmt.Sprintf("%s.v%d", modlistFile, tt.version))
+		if err != nil || !bytes.Equal(backup, bs.Bytes()) {
+			t.Errorf("%s\nExpected the original file as a backup\nerr: %v", tt.name, err)
+		}
+
+		if err := c.saveMods(); err != nil {
+			t.Fatal(err)
+		}
+		c.mods = nil
+		if err := c.readMods(); err != nil {
+			t.Fatalf("%s: reading the migrated file\nerr: %s", tt.name, err)
+		}
+		checkLegacyMods(t, tt.name+" migrated", c.mods)
+	}
+}
+
+func checkLegacyMods(t *testing.T, step string, mods []modEntry) {
+	t.Helper()
+	if len(mods) != len(legacyMods) {
+		t.Fatalf("%s\nReturned %d mods\nExpected: %d", step, len(mods), len(legacyMods))
+	}
+	for i, want := range legacyMods {
+		want.DownloadUrl = fileURL(want.FileId, want.Name)
+		if !reflect.DeepEqual(mods[i], want) {
+			t.Errorf("%s\nReturned: %+v\nExpected: %+v", step, mods[i], want)
+		}
+	}
+}
+
+func TestReadCorruptModlist(t *testing.T) {
+	var v0 bitstream.Bitstream
+	writeModsV0(t, &v0, legacyMods)
+
+	var v2 bitstream.Bitstream
+	writeHeader(&v2, modlistMagic, fileHeader{version: modlistV2, count: len(legacyMods)})
+	for _, m := range legacyMods {
+		writeModEntry(&v2, m)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"Truncated V0", v0.Bytes()[:len(v0.Bytes())-3], "Corrupt modlist file at entry 1"},
+		{"Truncated V2", v2.Bytes()[:len(v2.Bytes())-3], "Corrupt modlist file at entry 1 of 2"},
+		{"Trailing bytes", append(v2.Bytes()[:len(v2.Bytes()):len(v2.Bytes())], 0, 0), "2 unexpected trailing bytes"},
+		{"Truncated header", []byte(modlistMagic + "\x02\x00"), "Truncated header"},
+		{"Unknown version", []byte(modlistMagic + "\x09\x00\x00\x00\x00"), "Unknown modlist format version 9"},
+	} {
+		c := newTestCli(t, "y")
+		if err := os.WriteFile(modlistFile, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := c.readMods()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s\nReturned: %v\nExpected: %s", tt.name, err, tt.want)
+		}
+		if c.mods != nil {
+			t.Errorf("%s\nExpected no mods, got %d", tt.name, len(c.mods))
+		}
+		if _, err := os.Stat(modlistFile + ".v0"); err == nil {
+			t.Errorf("%s\nA corrupt file shouldn't be migrated", tt.name)
+		}
+	}
+}
+
+// savedNote reads the note of the first entry of the saved modlist
+func savedNote(t *testing.T) string {
+	t.Helper()
+	d, err := os.ReadFile(modlistFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods, _, err := decodeMods(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mods[0].Note
+}
+
+func TestDirty(t *testing.T) {
+	c := newTestCli(t, "y")
+	c.mods = []modEntry{{Id: 1, Name: "a.jar"}}
+	if err := c.saveMods(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		line  string
+		dirty bool
+		saved string
+	}{
+		{`note 1 "x"`, true, ""},
+		{"save", false, "x"},
+		{`note 1 "y"`, true, "x"},
+		{"undo", false, "x"},
+		{"redo", true, "x"},
+	} {
+		if err := c.run(t, tt.line); err != nil {
+			t.Fatalf("%s\nerr: %s", tt.line, err)
+		}
+		if c.dirty() != tt.dirty || strings.Contains(c.promptStr(), "*") != tt.dirty {
+			t.Errorf("%s\nReturned: dirty %v, prompt %q\nExpected: dirty %v", tt.line, c.dirty(), c.promptStr(), tt.dirty)
+		}
+		if note := savedNote(t); note != tt.saved {
+			t.Errorf("%s\nReturned saved note: %q\nExpected: %q", tt.line, note, tt.saved)
+		}
+	}
+}
+
+func TestQuitUnsaved(t *testing.T) {
+	for _, tt := range []struct {
+		answer  string
+		running bool
+		saved   string
+	}{
+		{"y", false, "x"},
+		{"", false, "x"},
+		{"n", false, ""},
+		{"c", true, ""},
+	} {
+		c := newTestCli(t, tt.answer)
+		c.mods = []modEntry{{Id: 1, Name: "a.jar"}}
+		if err := c.saveMods(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.run(t, `note 1 "x"`); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.run(t, "quit"); err != nil {
+			t.Fatal(err)
+		}
+		if c.Running != tt.running || savedNote(t) != tt.saved {
+			t.Errorf("Answer %q\nReturned: running %v, saved note %q\nExpected: running %v, saved note %q", tt.answer, c.Running, savedNote(t), tt.running, tt.saved)
+		}
+	}
+}
+
+func TestAutosave(t *testing.T) {
+	c := newTestCli(t, "y")
+	c.mods = []modEntry{{Id: 1, Name: "a.jar"}}
+	if err := c.saveMods(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		line  string
+		saved string
+	}{
+		{`note 1 "x"`, ""},
+		{"set autosave on", "x"},
+		{`note 1 "y"`, "y"},
+		{"set autosave off", "y"},
+		{`note 1 "z"`, "y"},
+	} {
+		if err := c.run(t, tt.line); err != nil {
+			t.Fatalf("%s\nerr: %s", tt.line, err)
+		}
+		c.autosaveMods()
+		if note := savedNote(t); note != tt.saved {
+			t.Errorf("%s\nReturned saved note: %q\nExpected: %q", tt.line, note, tt.saved)
+		}
+	}
+}
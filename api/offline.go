@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/stuff7/mcman/cache"
+)
+
+const queueFile = "queue"
+
+func (c *cli) SetOffline(offline bool) {
+	c.offline = offline
+	httpCache.Offline = offline
+}
+
+// enqueue records a network-only command so it can be replayed on the next
+// online session.
+func (c *cli) enqueue(line string) error {
+	if c.planning {
+		return fmt.Errorf("Cannot plan %s: %w", line, cache.ErrOffline)
+	}
+
+	queue, err := readQueue()
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(queue, line) {
+		queue = append(queue, line)
+	}
+
+	if err := os.WriteFile(queueFile, []byte(strings.Join(queue, "\n")+"\n"), 0666); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s~ Offline. Queued %s%s%s for the next online session\n", clr(45), BOLD, line, RESET)
+	return nil
+}
+
+func (c *cli) replayQueue(ctx context.Context) error {
+	queue, err := readQueue()
+	if err != nil || len(queue) == 0 {
+		return err
+	}
+
+	if err := os.Remove(queueFile); err != nil {
+		return err
+	}
+
+	fmt.Printf("Replaying %s%d%s queued commands\n", clr(157), len(queue), RESET)
+	for _, line := range queue {
+		fmt.Printf("%s%s%s\n", clr(248), line, RESET)
+		cmd, _ := c.parseCmd(tokenize(line))
+		if err := cmd.run(ctx); err != nil {
+			fmt.Printf("%s%s%s\n", clr(220), err, RESET)
+		}
+	}
+
+	return nil
+}
+
+func readQueue() ([]string, error) {
+	data, err := os.ReadFile(queueFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(strings.Split(string(data), "\n"), func(l string) bool {
+		return strings.TrimSpace(l) == ""
+	}), nil
+}
+
+func isOffline(err error) bool {
+	return errors.Is(err, cache.ErrOffline)
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stuff7/mcman/htmlterm"
+	"github.com/stuff7/mcman/slc"
+)
+
+// outputFlags select a machine-readable format for the commands that print
+// mods. Every format is a list of the records below, whose json names are the
+// CSV and TSV columns. The README documents them and they should only change
+// by adding fields at the end.
+var outputFlags = []string{"json", "csv", "tsv"}
+
+type outputFormat int
+
+const (
+	outputText outputFormat = iota
+	outputJSON
+	outputCSV
+	outputTSV
+)
+
+func outputOf(ctx context.Context) (outputFormat, error) {
+	format := outputText
+	for i, name := range outputFlags {
+		if !hasFlag(ctx, name) {
+			continue
+		}
+		if format != outputText {
+			return outputText, errors.New("Only one of --json, --csv or --tsv can be used")
+		}
+		format = outputFormat(i + 1)
+	}
+	return format, nil
+}
+
+// writeOutput prints records as a JSON array or as CSV/TSV with a header row.
+// Lists are joined with ";" and fields tagged csv:"-" are left out of CSV/TSV.
+func writeOutput[T any](format outputFormat, records []T) error {
+	if format == outputJSON {
+		if records == nil {
+			records = []T{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(records)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	if format == outputTSV {
+		w.Comma = '\t'
+	}
+
+	typ := reflect.TypeFor[T]()
+	var columns []int
+	var header []string
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if f.Tag.Get("csv") == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		columns = append(columns, i)
+		header = append(header, name)
+	}
+
+	rows := [][]string{header}
+	for _, r := range records {
+		v := reflect.ValueOf(r)
+		rows = append(rows, slc.Map(columns, func(i int) string { return csvValue(v.Field(i)) }))
+	}
+
+	return w.WriteAll(rows)
+}
+
+func csvValue(v reflect.Value) string {
+	switch val := v.Interface().(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case encoding.TextMarshaler:
+		text, _ := val.MarshalText()
+		return string(text)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = csvValue(v.Index(i))
+		}
+		return strings.Join(items, ";")
+	}
+
+	return ""
+}
+
+type modRecord struct {
+	Index       int       `json:"index"`
+	ID          int       `json:"id"`
+	FileID      int       `json:"fileId"`
+	Name        string    `json:"name"`
+	Class       string    `json:"class"`
+	GameVersion string    `json:"gameVersion"`
+	Loader      string    `json:"loader"`
+	Fallback    string    `json:"fallback"`
+	Side        side      `json:"side"`
+	Deps        []int     `json:"deps"`
+	Worlds      []string  `json:"worlds"`
+	Stranded    bool      `json:"stranded"`
+	Uploaded    time.Time `json:"uploaded"`
+	DownloadURL string    `json:"downloadUrl"`
+	Tags        []string  `json:"tags"`
+	Note        string    `json:"note"`
+	Disabled    bool      `json:"disabled"`
+}
+
+func modRecords(mods []modEntry, idxs []int) []modRecord {
+	var records []modRecord
+	for _, i := range idxs {
+		m := mods[i]
+
+		var fallback string
+		if m.Fallback != 0 {
+			fallback = modLoaderKeywords[m.Fallback]
+		}
+		records = append(records, modRecord{
+			Index:       i,
+			ID:          m.Id,
+			FileID:      m.FileId,
+			Name:        m.Name,
+			Class:       classOf(m.Class).name,
+			GameVersion: m.GameVersion,
+			Loader:      modLoaderKeywords[m.ModLoader],
+			Fallback:    fallback,
+			Side:        m.Side,
+			Deps:        append([]int{}, m.Deps...),
+			Worlds:      append([]string{}, m.Worlds...),
+			Stranded:    m.Stranded,
+			Uploaded:    m.Uploaded,
+			DownloadURL: m.DownloadUrl,
+			Tags:        append([]string{}, m.Tags...),
+			Note:        m.Note,
+			Disabled:    m.Disabled,
+		})
+	}
+	return records
+}
+
+type searchRecord struct {
+	Index     int       `json:"index"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Class     string    `json:"class"`
+	Summary   string    `json:"summary"`
+	Downloads int       `json:"downloads"`
+	Likes     int       `json:"likes"`
+	Installed bool      `json:"installed"`
+	Modified  time.Time `json:"modified"`
+	Tags      []string  `json:"tags"`
+}
+
+func (c *cli) searchRecord(i int, mod cfMod) searchRecord {
+	return searchRecord{
+		Index:     i + 1,
+		ID:        mod.ID,
+		Name:      mod.Name,
+		Class:     classOf(mod.Class).name,
+		Summary:   mod.Summary,
+		Downloads: mod.DownloadCount,
+		Likes:     mod.Likes,
+		Installed: c.installed(mod.ID),
+		Modified:  mod.Modified,
+		Tags:      append([]string{}, c.tagsOf(mod.ID)...),
+	}
+}
+
+type infoRecord struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Class       string       `json:"class"`
+	Summary     string       `json:"summary"`
+	Downloads   int          `json:"downloads"`
+	Likes       int          `json:"likes"`
+	Installed   bool         `json:"installed"`
+	Created     time.Time    `json:"created"`
+	Modified    time.Time    `json:"modified"`
+	Released    time.Time    `json:"released"`
+	Description string       `json:"description"`
+	LatestFiles []fileRecord `json:"latestFiles" csv:"-"`
+}
+
+func (c *cli) infoRecord(mod cfMod, description string) infoRecord {
+	return infoRecord{
+		ID:          mod.ID,
+		Name:        mod.Name,
+		Class:       classOf(mod.Class).name,
+		Summary:     mod.Summary,
+		Downloads:   mod.DownloadCount,
+		Likes:       mod.Likes,
+		Installed:   c.installed(mod.ID),
+		Created:     mod.Created,
+		Modified:    mod.Modified,
+		Released:    mod.Released,
+		Description: htmlterm.Text(description),
+		LatestFiles: slc.Map(mod.Files, func(f CfFile) fileRecord { return newFileRecord(mod.ID, loaderAny, f) }),
+	}
+}
+
+type fileRecord struct {
+	ModID        int       `json:"modId"`
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Release      string    `json:"release"`
+	Loader       string    `json:"loader"`
+	GameVersions []string  `json:"gameVersions"`
+	Side         side      `json:"side"`
+	Size         int       `json:"size"`
+	Deps         []int     `json:"deps"`
+	Uploaded     time.Time `json:"uploaded"`
+	DownloadURL  string    `json:"downloadUrl"`
+}
+
+// newFileRecord describes f, a file of mod id found for loader
+func newFileRecord(id, loader int, f CfFile) fileRecord {
+	downloadURL := guessURL(&f)
+	if f.DownloadURL != nil {
+		downloadURL = *f.DownloadURL
+	}
+
+	return fileRecord{
+		ModID:        id,
+		ID:           f.ID,
+		Name:         f.Name,
+		Release:      f.Release.String(),
+		Loader:       modLoaderKeywords[loader],
+		GameVersions: append([]string{}, f.SupportedVersions...),
+		Side:         fileSide(&f),
+		Size:         f.Size,
+		Deps:         append([]int{}, requiredDeps(&f)...),
+		Uploaded:     f.Uploaded,
+		DownloadURL:  downloadURL,
+	}
+}
+
+type compatRecord struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	FileID  int    `json:"fileId"`
+	File    string `json:"file"`
+	Release string `json:"release"`
+	Loader  string `json:"loader"`
+	Error   string `json:"error"`
+}
+
+func (c *cli) compatRecords(compat []modCompat) []compatRecord {
+	return slc.Map(compat, func(mc modCompat) compatRecord {
+		m := c.mods[mc.idx]
+		r := compatRecord{ID: m.Id, Name: m.Name, Status: compatKeywords[mc.status]}
+		if mc.err != nil {
+			r.Error = mc.err.Error()
+		}
+		if mc.file != nil {
+			r.FileID = mc.file.ID
+			r.File = mc.file.Name
+			r.Release = mc.file.Release.String()
+			r.Loader = modLoaderKeywords[mc.loader]
+		}
+		return r
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/stuff7/mcman/cache"
 	"github.com/stuff7/mcman/readln"
 	"github.com/stuff7/mcman/slc"
 )
@@ -20,6 +21,7 @@ const (
 	Symbol
 	Keyword
 	Space
+	Flag
 )
 
 type token struct {
@@ -27,6 +29,7 @@ type token struct {
 	val      string
 	lst      int
 	keywords []string
+	hint     string
 }
 
 func newToken(typ tokenType, in string, i *int, cond func(byte) bool) token {
@@ -148,20 +151,249 @@ func remCmdKwords(tokens []token) []token {
 	return tokens
 }
 
-func addCmdKwords(tokens []token) []token {
+// tagCmdKwords suggests the tags already in use after the mod id
+func (c *cli) tagCmdKwords(tokens []token) []token {
+	var tags []string
+	for _, m := range c.mods {
+		for _, t := range m.Tags {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+
+	for i, w := range words(tokens) {
+		if i != 0 {
+			markWord(w, Ident, tags)
+		}
+	}
+
+	return tokens
+}
+
+func loaderCmdKwords(tokens []token) []token {
+	var i int
+	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == Unknown {
+		t.autocomplete(Keyword, []string{"versions", "install"})
+	}
+
+	return tokens
+}
+
+func worldsCmdKwords(tokens []token) []token {
+	var i int
+	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == Unknown {
+		t.autocomplete(Keyword, []string{"set"})
+	}
+
+	return tokens
+}
+
+// bisectCmdKwords completes the steps of bisect and the filter after start
+func bisectCmdKwords(tokens []token) []token {
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil || t.typ != Unknown {
+		return tokens
+	}
+
+	t.autocomplete(Keyword, []string{"start", "good", "bad", "reset"})
+	if t.typ == Keyword && t.val == "start" {
+		listCmdKwords(tokens[i:])
+	}
+	return tokens
+}
+
+func listCmdKwords(tokens []token) []token {
+	const (
+		option = iota
+		value
+		sideValue
+		cond
+		afterCond
+		sortField
+		sortOrder
+	)
+
+	state := option
+	for _, w := range words(tokens) {
+		text := joinTokens(w)
+		if state == afterCond || state == sortOrder {
+			next := []string{"and", "or"}
+			if state == sortOrder {
+				next = []string{"asc", "desc"}
+			}
+			state = option
+			if slices.Contains(next, text) {
+				markWord(w, Keyword, next)
+				if text == "and" || text == "or" {
+					state = cond
+				}
+				continue
+			}
+		}
+
+		switch state {
+		case option:
+			markWord(w, Keyword, listKeywords)
+			switch text {
+			case "where":
+				state = cond
+			case "sort":
+				state = sortField
+			case "search", "id", "tag":
+				state = value
+			case "side":
+				state = sideValue
+			}
+		case value:
+			state = option
+		case sideValue:
+			markWord(w, Keyword, sideKeywords[sideClient:])
+			state = option
+		case cond:
+			if text == "not" {
+				markWord(w, Keyword, []string{"not"})
+				continue
+			}
+			if w[0].typ == Unknown {
+				w[0].autocomplete(Ident, filterFields)
+			}
+			state = afterCond
+		case sortField:
+			markWord(w, Ident, filterFields)
+			state = sortOrder
+		}
+	}
+
+	return tokens
+}
+
+// markWord gives every token of w typ when w is one of keywords and suggests
+// them while w is a single unfinished token.
+func markWord(w []token, typ tokenType, keywords []string) {
+	if slices.Contains(keywords, joinTokens(w)) {
+		for i := range w {
+			w[i].typ = typ
+		}
+		return
+	}
+
+	if len(w) == 1 && w[0].typ == Unknown {
+		w[0].keywords = keywords
+	}
+}
+
+// sideCmdKwords completes an optional side <client|server|both> after the
+// other arguments of a command.
+func sideCmdKwords(tokens []token) []token {
 	var i int
 	for {
 		t := nextNonSpaceToken(tokens, &i)
-		if t == nil || t.typ != Unknown {
+		if t == nil {
 			break
 		}
 
-		t.autocomplete(Keyword, []string{"search", "id"})
+		if t.typ == Unknown {
+			t.autocomplete(Keyword, []string{"side"})
+		}
+		if t.val == "side" {
+			sideValueKwords(tokens, &i)
+		}
 	}
 
 	return tokens
 }
 
+func sideValueKwords(tokens []token, i *int) {
+	if t := nextNonSpaceToken(tokens, i); t != nil && t.typ == Unknown {
+		t.autocomplete(Keyword, sideKeywords[sideClient:])
+	}
+}
+
+// searchCmdKwords marks the search options. Their names only start an option
+// when a value follows them and they come after the filter, or first to refine
+// the last search. Anywhere else they are part of the filter.
+func (c *cli) searchCmdKwords(tokens []token) []token {
+	var t, prevT *token
+	var i int
+	filtered := false
+	for {
+		t = nextNonSpaceToken(tokens, &i)
+		if t == nil {
+			break
+		}
+
+		if prevT != nil {
+			switch prevT.val {
+			case "sort":
+				t.autocomplete(Keyword, sortFieldKeywords[1:])
+			case "order":
+				t.autocomplete(Keyword, sortOrderKeywords)
+			case "class":
+				t.autocomplete(Keyword, classKeywords)
+			}
+			prevT = nil
+			continue
+		}
+
+		if t.typ == Unknown && (filtered || c.search.PageSize != 0) {
+			j := i
+			v := nextNonSpaceToken(tokens, &j)
+			if v != nil && (v.typ != Unknown || v.val != "") {
+				t.autocomplete(Keyword, searchKeywords)
+			} else {
+				t.keywords = searchKeywords
+			}
+		}
+
+		if t.typ == Keyword {
+			prevT = t
+		} else {
+			filtered = true
+		}
+	}
+
+	return tokens
+}
+
+func (c *cli) resultCmdKwords(keywords []string) func([]token) []token {
+	indices := make([]string, len(c.results))
+	for i := range c.results {
+		indices[i] = strconv.Itoa(i + 1)
+	}
+
+	return func(tokens []token) []token {
+		var t, prevT *token
+		var i int
+		for {
+			t = nextNonSpaceToken(tokens, &i)
+			if t == nil {
+				break
+			}
+
+			if prevT != nil && prevT.typ == Keyword {
+				prevT = nil
+				continue
+			}
+
+			switch t.typ {
+			case Unknown:
+				t.autocomplete(Keyword, keywords)
+			case Number:
+				t.keywords = indices
+				if m := c.result(t.parseNumber()); m != nil {
+					t.hint = m.Name
+				}
+			}
+
+			prevT = t
+		}
+
+		return tokens
+	}
+}
+
 func (c *cli) queryCmdKwords(tokens []token) []token {
 	var t, prevT *token
 	var i int
@@ -178,9 +410,14 @@ func (c *cli) queryCmdKwords(tokens []token) []token {
 			case "gameVersion":
 				i--
 				tokens = c.parseVersion(tokens, i)
+			case "offline", "autosave":
+				t.autocomplete(Keyword, []string{"on", "off"})
+			case "fallback":
+				t.autocomplete(Keyword, append([]string{"none"}, modLoaderKeywords[1:]...))
+				continue
 			}
 		} else if t.typ == Unknown {
-			t.autocomplete(Ident, queryFields)
+			t.autocomplete(Ident, settingFields)
 		}
 
 		prevT = t
@@ -189,6 +426,30 @@ func (c *cli) queryCmdKwords(tokens []token) []token {
 	return tokens
 }
 
+func (c *cli) targetCmdKwords(tokens []token) []token {
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil || t.typ != Number {
+		return tokens
+	}
+
+	tokens = c.parseVersion(tokens, i-1)
+	if t = nextNonSpaceToken(tokens, &i); t != nil && t.typ == Unknown {
+		t.autocomplete(Keyword, modLoaderKeywords)
+	}
+
+	return tokens
+}
+
+func updateCmdKwords(tokens []token) []token {
+	var i int
+	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == Unknown {
+		t.autocomplete(Keyword, []string{"check"})
+	}
+
+	return tokens
+}
+
 func versionCmdKwords(tokens []token) []token {
 	var t *token
 	var i int
@@ -204,6 +465,43 @@ func versionCmdKwords(tokens []token) []token {
 	return tokens
 }
 
+func restoreCmdKwords(tokens []token) []token {
+	var i int
+	if t := nextNonSpaceToken(tokens, &i); t != nil && t.typ == Unknown {
+		t.autocomplete(Keyword, []string{modlistFile, cfgFile})
+	}
+
+	return tokens
+}
+
+func cacheCmdKwords(tokens []token) []token {
+	var i int
+	t := nextNonSpaceToken(tokens, &i)
+	if t == nil || t.typ != Unknown {
+		return tokens
+	}
+
+	t.autocomplete(Keyword, []string{"stats", "clear", "ttl"})
+	if t.val != "ttl" {
+		return tokens
+	}
+
+	if t = nextNonSpaceToken(tokens, &i); t != nil && t.typ == Unknown {
+		t.autocomplete(Ident, slc.Map(httpCache.Rules, func(r cache.Rule) string { return r.Name }))
+	}
+
+	return tokens
+}
+
+func completeFlags(tokens []token, flags []string) {
+	names := slc.Map(flags, func(f string) string { return "--" + f })
+	for i := range tokens {
+		if t := &tokens[i]; t.typ == Flag && !slices.Contains(names, t.val) {
+			t.keywords = names
+		}
+	}
+}
+
 func (t *token) autocomplete(to tokenType, keywords []string) {
 	if slices.Contains(keywords, t.val) {
 		t.typ = to
@@ -212,8 +510,10 @@ func (t *token) autocomplete(to tokenType, keywords []string) {
 	}
 }
 
+// nextNonSpaceToken skips flags along with whitespace, Cmd.run hands those to
+// the command separately.
 func nextNonSpaceToken(tokens []token, i *int) *token {
-	for *i < len(tokens) && tokens[*i].typ == Space {
+	for *i < len(tokens) && (tokens[*i].typ == Space || tokens[*i].typ == Flag) {
 		*i++
 	}
 
@@ -226,6 +526,27 @@ func nextNonSpaceToken(tokens []token, i *int) *token {
 	return t
 }
 
+// words splits tokens at whitespace, so a word like top-level or loader=Fabric
+// holds every token it was split into. The words share tokens' storage.
+func words(tokens []token) [][]token {
+	var ws [][]token
+	start := -1
+	for i, t := range tokens {
+		inWord := t.typ != Space && t.typ != Flag && (t.typ != Unknown || t.val != "")
+		switch {
+		case inWord && start == -1:
+			start = i
+		case !inWord && start != -1:
+			ws = append(ws, tokens[start:i])
+			start = -1
+		}
+	}
+	if start != -1 {
+		ws = append(ws, tokens[start:])
+	}
+	return ws
+}
+
 func joinTokens(tokens []token) string {
 	var b strings.Builder
 	for i := 0; i < len(tokens); i++ {
@@ -243,6 +564,8 @@ func tokenize(in string) []token {
 			tokens = append(tokens, newToken(Number, in, &i, isDigit))
 		case isAlpha(b):
 			tokens = append(tokens, newToken(Unknown, in, &i, isAlphanumeric))
+		case b == '-' && strings.HasPrefix(in[i:], "--"):
+			tokens = append(tokens, newToken(Flag, in, &i, func(b byte) bool { return b == '-' || isAlphanumeric(b) }))
 		case readln.IsSpace(b):
 			tokens = append(tokens, newToken(Space, in, &i, readln.IsSpace))
 		case b == '"':
@@ -270,9 +593,9 @@ func tokenize(in string) []token {
 
 	l := slc.Last(tokens)
 	if l == nil {
-		tokens = append(tokens, token{Unknown, "", 0, nil})
+		tokens = append(tokens, token{typ: Unknown})
 	} else if l.typ == Space {
-		tokens = append(tokens, token{Unknown, "", l.lst, nil})
+		tokens = append(tokens, token{typ: Unknown, lst: l.lst})
 	}
 
 	return tokens
@@ -294,11 +617,17 @@ func renderTokens(tokens []token, k readln.Key, s *string, p *int) string {
 			b.WriteString(clr(85))
 		case Symbol:
 			b.WriteString(clr(213))
+		case Flag:
+			b.WriteString(clr(141))
 		default:
 			b.WriteString(RESET)
 		}
 
 		b.WriteString(t.val)
+		if t.lst == *p && t.hint != "" {
+			b.WriteString(clr(248) + " " + t.hint + RESET)
+		}
+
 		if t.lst == *p && t.keywords != nil {
 			closest := findClosest(t.val, t.keywords)
 			if closest == nil {
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResultHints(t *testing.T) {
+	c := &cli{results: []cfMod{{ID: 10, Name: "Sodium"}, {ID: 20, Name: "Iris"}}}
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"add 1 2", []string{"Sodium", "Iris"}},
+		{"add id 394468 2", []string{"", "Iris"}},
+		{"info id 1 id 2 1", []string{"", "", "Sodium"}},
+		{"files 2", []string{"Iris"}},
+	} {
+		_, tokens := c.parseCmd(tokenize(tc.line))
+		var got []string
+		for _, tok := range tokens {
+			if tok.typ == Number {
+				got = append(got, tok.hint)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s\nReturned: %#+v\nExpected: %#+v", tc.line, got, tc.want)
+		}
+	}
+}
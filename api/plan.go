@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stuff7/mcman/readln"
+)
+
+// planFlags are accepted by every command that can be planned
+var planFlags = []string{"dry-run"}
+
+var readLn = readln.ReadLn
+
+type confirmKey struct{}
+
+// planCmd runs sub as a dry run and asks whether to apply the result.
+func (c *cli) planCmd(ctx context.Context, sub Cmd) error {
+	if sub.Run == nil || len(sub.flags) == 0 {
+		return errors.New("Usage: plan <add|rem|import|update|migrate> [args...]")
+	}
+
+	return sub.run(context.WithValue(ctx, confirmKey{}, true))
+}
+
+// plan runs fn against the modlist and reverts whatever it changed, printing
+// the changes instead. When confirm is set it asks whether to apply them.
+func (c *cli) plan(desc string, confirm bool, fn func() error) error {
+	before := cloneMods(c.mods)
+	prevQuery := c.query
+	c.planning = true
+	c.planLog.Reset()
+	err := fn()
+	c.planning = false
+
+	op := c.diff(desc, before, prevQuery)
+	c.mods, c.query = before, prevQuery
+
+	if op.empty() {
+		if err == nil {
+			fmt.Println("Nothing to change")
+		}
+		return err
+	}
+
+	fmt.Printf("Plan %s%s%s\n%s", BOLD, desc, RESET, c.planLog.String())
+	if err != nil || !confirm {
+		return err
+	}
+
+	if !c.confirm("Apply?") {
+		fmt.Println("Nothing changed")
+		return nil
+	}
+
+	return c.mutate(desc, func() error {
+		c.mods = op.apply(c.mods)
+		if op.query != nil {
+			c.query = op.query.to
+		}
+		return nil
+	})
+}
+
+// confirm asks a yes/no question defaulting to no.
+func (c *cli) confirm(question string) bool {
+	answer := c.ask(question + " [y/N]")
+	return answer == "y" || answer == "yes"
+}
+
+// ask reads a lowercase answer to question. Failing to read gives an empty
+// answer, which picks the default. Commands only ask with the modlist in a
+// consistent state, so a signal may save and exit while they wait.
+func (c *cli) ask(question string) string {
+	var answer string
+	c.busy.Unlock()
+	err := readLn(question+" ", &answer)
+	c.busy.Lock()
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(answer))
+}
+
+// logf prints progress of a modlist change, or keeps it for the plan while
+// the change is only being planned.
+func (c *cli) logf(format string, a ...any) {
+	if c.planning {
+		fmt.Fprintf(&c.planLog, format, a...)
+	} else {
+		fmt.Printf(format, a...)
+	}
+}
+
+// warnf is logf for warnings, which go to stderr instead when the command
+// prints machine-readable output.
+func (c *cli) warnf(ctx context.Context, format string, a ...any) {
+	if out, _ := outputOf(ctx); out != outputText && !c.planning {
+		fmt.Fprintf(os.Stderr, format, a...)
+	} else {
+		c.logf(format, a...)
+	}
+}
+
+// warnGuessedURL tells that f's download URL had to be guessed.
+func (c *cli) warnGuessedURL(ctx context.Context, f *CfFile) {
+	if f.DownloadURL == nil {
+		c.warnf(ctx, "%s! %sMissing Download URL for mod %+v. Trying to guess it%s\n", clr(227), BOLD, f.Name, RESET)
+	}
+}
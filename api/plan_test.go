@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// testAdd returns a cli with an empty modlist where mod 1 requires mod 2
+func testAdd(t *testing.T, answer string) *cli {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1":       cfMod{ID: 1, Name: "A", Class: classMod},
+		"/v1/mods/1/files": []CfFile{{ID: 11, Name: "a.jar", Dependencies: []Dependency{{ModId: 2, Relation: RequiredDependency}}}},
+		"/v1/mods/2":       cfMod{ID: 2, Name: "B", Class: classMod},
+		"/v1/mods/2/files": []CfFile{{ID: 21, Name: "b.jar"}},
+	})
+	return newTestCli(t, answer)
+}
+
+func modIds(mods []modEntry) []int {
+	ids := make([]int, len(mods))
+	for i, m := range mods {
+		ids[i] = m.Id
+	}
+	return ids
+}
+
+func TestDryRun(t *testing.T) {
+	for _, tt := range []struct {
+		line   string
+		answer string
+		before []modEntry
+		out    []string
+		after  int
+	}{
+		{"add id 1 --dry-run", "y", nil, []string{"Plan", "a.jar", "b.jar"}, 0},
+		{"plan add id 1", "n", nil, []string{"a.jar", "b.jar", "Nothing changed"}, 0},
+		{"plan add id 1", "y", nil, []string{"a.jar", "b.jar"}, 2},
+		{"rem id 1 --dry-run", "y", []modEntry{{Id: 1, Name: "a.jar", Deps: []int{2}}, {Id: 2, Name: "b.jar"}}, []string{"a.jar", "b.jar"}, 2},
+		{"plan rem id 1", "y", []modEntry{{Id: 1, Name: "a.jar", Deps: []int{2}}, {Id: 2, Name: "b.jar"}, {Id: 3, Name: "c.jar"}}, []string{"a.jar", "b.jar"}, 1},
+	} {
+		c := testAdd(t, tt.answer)
+		c.mods = tt.before
+
+		var err error
+		out := captureStdout(t, func() { err = c.run(t, tt.line) })
+		if err != nil {
+			t.Fatalf("%s (%s)\nerr: %s", tt.line, tt.answer, err)
+		}
+
+		for _, want := range tt.out {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s (%s)\nReturned:\n%s\nExpected it to mention %q", tt.line, tt.answer, out, want)
+			}
+		}
+		if len(c.mods) != tt.after {
+			t.Errorf("%s (%s)\nReturned mods: %v\nExpected %d mods", tt.line, tt.answer, modIds(c.mods), tt.after)
+		}
+		if applied := len(c.undoOps) != 0; applied != (len(tt.before) != tt.after) {
+			t.Errorf("%s (%s)\nUndo history: %d operations", tt.line, tt.answer, len(c.undoOps))
+		}
+	}
+}
+
+func TestGuessedURLWarning(t *testing.T) {
+	c := testAdd(t, "y")
+
+	var err error
+	out := captureStdout(t, func() { err = c.run(t, "add id 1 --dry-run") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := strings.Index(out, "Plan")
+	if plan < 0 || strings.Count(out, "Missing Download URL") != 2 || strings.Index(out, "Missing Download URL") < plan {
+		t.Errorf("Returned:\n%s\nExpected a warning per guessed file, only inside the plan", out)
+	}
+
+	for _, tt := range []struct {
+		flags []string
+		out   bool
+	}{{nil, true}, {[]string{"json"}, false}, {[]string{"csv"}, false}} {
+		ctx := context.WithValue(context.Background(), flagsKey{}, tt.flags)
+		out := captureStdout(t, func() { c.warnGuessedURL(ctx, &CfFile{ID: 11, Name: "a.jar"}) })
+		if strings.Contains(out, "a.jar") != tt.out {
+			t.Errorf("Flags %v\nReturned stdout:\n%s\nExpected the warning on stdout: %v", tt.flags, out, tt.out)
+		}
+	}
+}
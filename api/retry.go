@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var limiter = newRateLimiter(4, 8)
+var retrying = &retryTransport{
+	Base:       http.DefaultTransport,
+	Limiter:    limiter,
+	MaxRetries: 5,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+var dlClient = &http.Client{Transport: retrying}
+
+// rateLimiter is a token bucket shared by every outgoing request.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond, burst float64) *rateLimiter {
+	return &rateLimiter{rate: perSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	return sleep(ctx, l.reserve())
+}
+
+type retryTransport struct {
+	Base       http.RoundTripper
+	Limiter    *rateLimiter
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := t.Limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		res, err := t.Base.RoundTrip(req)
+		if attempt >= t.MaxRetries || ctx.Err() != nil || !idempotent(req) || (err == nil && !isRetryable(res.StatusCode)) {
+			return res, err
+		}
+
+		delay := t.backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+				delay = min(after, t.MaxDelay)
+			}
+			res.Body.Close()
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff doubles the delay on every attempt and picks a random point in its
+// upper half so concurrent clients don't retry in lockstep.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	delay := min(t.BaseDelay<<attempt, t.MaxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// idempotent reports whether req can be sent again without side effects, the
+// same way net/http decides it
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func isRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	for _, tt := range []struct {
+		header   string
+		min, max time.Duration
+		ok       bool
+	}{
+		{"", 0, 0, false},
+		{"3", 3 * time.Second, 3 * time.Second, true},
+		{future, 58 * time.Second, time.Minute, true},
+		{past, 0, 0, true},
+		{"soon", 0, 0, false},
+	} {
+		d, ok := retryAfter(tt.header)
+		if ok != tt.ok || d < tt.min || d > tt.max {
+			t.Errorf("retryAfter(%#+v)\nReturned: %s %t\nExpected: %s..%s %t", tt.header, d, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	rt := &retryTransport{BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+	for _, tt := range []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 500 * time.Millisecond, time.Second},
+		{1, time.Second, 2 * time.Second},
+		{2, 2 * time.Second, 4 * time.Second},
+		{10, 2 * time.Second, 4 * time.Second},
+	} {
+		for range 20 {
+			if d := rt.backoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Fatalf("backoff(%d)\nReturned: %s\nExpected: %s..%s", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+// retryServer answers every request with the statuses in order, repeating the
+// last one
+func retryServer(t *testing.T, header http.Header, statuses ...int) (*http.Client, string, *int) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(statuses[min(calls, len(statuses)-1)])
+		calls++
+	}))
+	t.Cleanup(srv.Close)
+
+	rt := &retryTransport{
+		Base:       http.DefaultTransport,
+		Limiter:    newRateLimiter(1000, 1000),
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	}
+	return &http.Client{Transport: rt}, srv.URL, &calls
+}
+
+func TestRetry(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		method   string
+		header   http.Header
+		statuses []int
+		status   int
+		calls    int
+	}{
+		{"server errors", http.MethodGet, nil, []int{503, 500, 200}, 200, 3},
+		{"gives up", http.MethodGet, nil, []int{503}, 503, 4},
+		{"rate limited", http.MethodGet, http.Header{"Retry-After": {"0"}}, []int{429, 200}, 200, 2},
+		{"client error", http.MethodGet, nil, []int{404, 200}, 404, 1},
+		{"post", http.MethodPost, nil, []int{503, 200}, 503, 1},
+	} {
+		client, url, calls := retryServer(t, tt.header, tt.statuses...)
+		req, _ := http.NewRequest(tt.method, url, strings.NewReader("body"))
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("%s\nerr: %s", tt.name, err)
+			continue
+		}
+		res.Body.Close()
+
+		if res.StatusCode != tt.status || *calls != tt.calls {
+			t.Errorf("%s\nReturned: %d after %d calls\nExpected: %d after %d calls", tt.name, res.StatusCode, *calls, tt.status, tt.calls)
+		}
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	client, url, calls := retryServer(t, http.Header{"Retry-After": {"60"}}, 503)
+	client.Transport.(*retryTransport).MaxDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+	start := time.Now()
+	_, err := client.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second || *calls != 1 {
+		t.Errorf("Waiting should stop with the context\nerr: %v\ntook: %s\ncalls: %d", err, time.Since(start), *calls)
+	}
+}
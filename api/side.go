@@ -0,0 +1,143 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// side is the environment a mod runs in
+type side int
+
+const (
+	sideUnknown side = iota
+	sideClient
+	sideServer
+	sideBoth
+)
+
+var sideKeywords = []string{"unknown", "client", "server", "both"}
+
+func (s side) String() string {
+	if int(s) < len(sideKeywords) {
+		return sideKeywords[s]
+	}
+	return sideKeywords[sideUnknown]
+}
+
+func (s side) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *side) UnmarshalText(text []byte) error {
+	idx := slices.Index(sideKeywords, string(text))
+	if idx == -1 {
+		return fmt.Errorf("Unknown side %q", text)
+	}
+	*s = side(idx)
+	return nil
+}
+
+// runsOn reports whether a mod of side s belongs in the set for target. Mods
+// of unknown side are kept in every set.
+func (s side) runsOn(target side) bool {
+	return s == sideUnknown || s == sideBoth || target == sideBoth || s == target
+}
+
+// fileSide reads the environment tags CurseForge lists among the game versions
+// of a file.
+func fileSide(f *CfFile) side {
+	client := slices.Contains(f.SupportedVersions, "Client")
+	server := slices.Contains(f.SupportedVersions, "Server")
+	switch {
+	case client && server:
+		return sideBoth
+	case client:
+		return sideClient
+	case server:
+		return sideServer
+	}
+	return sideUnknown
+}
+
+// jarSide reads the environment a mod jar declares in its loader metadata.
+func jarSide(path string) (side, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return sideUnknown, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		switch f.Name {
+		case "fabric.mod.json":
+			var meta struct {
+				Environment string `json:"environment"`
+			}
+			if err := readZipJSON(f, &meta); err != nil {
+				return sideUnknown, err
+			}
+			return envSide(meta.Environment, "client", "server"), nil
+		case "quilt.mod.json":
+			var meta struct {
+				Minecraft struct {
+					Environment string `json:"environment"`
+				} `json:"minecraft"`
+			}
+			if err := readZipJSON(f, &meta); err != nil {
+				return sideUnknown, err
+			}
+			return envSide(meta.Minecraft.Environment, "client", "dedicated_server"), nil
+		case "META-INF/mods.toml", "META-INF/neoforge.mods.toml":
+			return tomlSide(f)
+		}
+	}
+
+	return sideUnknown, nil
+}
+
+func envSide(env, client, server string) side {
+	switch env {
+	case client:
+		return sideClient
+	case server:
+		return sideServer
+	}
+	return sideBoth
+}
+
+func readZipJSON(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// tomlSide looks for the clientSideOnly key of (Neo)Forge metadata. Forge mods
+// don't have to declare a side, so not finding it means the side is unknown.
+func tomlSide(f *zip.File) (side, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return sideUnknown, err
+	}
+	defer rc.Close()
+
+	sc := bufio.NewScanner(rc)
+	for sc.Scan() {
+		key, val, ok := strings.Cut(sc.Text(), "=")
+		if ok && strings.TrimSpace(key) == "clientSideOnly" {
+			if strings.TrimSpace(val) == "true" {
+				return sideClient, nil
+			}
+			return sideBoth, nil
+		}
+	}
+
+	return sideUnknown, sc.Err()
+}
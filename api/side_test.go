@@ -0,0 +1,119 @@
+package api
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFileSide(t *testing.T) {
+	for _, tt := range []struct {
+		versions []string
+		want     side
+	}{
+		{[]string{"1.20.1", "Fabric", "Client"}, sideClient},
+		{[]string{"1.20.1", "Server"}, sideServer},
+		{[]string{"Client", "1.20.1", "Server"}, sideBoth},
+		{[]string{"1.20.1", "Fabric"}, sideUnknown},
+	} {
+		if got := fileSide(&CfFile{SupportedVersions: tt.versions}); got != tt.want {
+			t.Errorf("%v\nReturned: %s\nExpected: %s", tt.versions, got, tt.want)
+		}
+	}
+}
+
+// writeJar writes a jar holding a single metadata file
+func writeJar(t *testing.T, path, name, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	if name != "" {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJarSide(t *testing.T) {
+	dir := t.TempDir()
+	for i, tt := range []struct {
+		name    string
+		file    string
+		content string
+		want    side
+	}{
+		{"Fabric client", "fabric.mod.json", `{"environment": "client"}`, sideClient},
+		{"Fabric server", "fabric.mod.json", `{"environment": "server"}`, sideServer},
+		{"Fabric any", "fabric.mod.json", `{"environment": "*"}`, sideBoth},
+		{"Fabric unset", "fabric.mod.json", `{}`, sideBoth},
+		{"Quilt server", "quilt.mod.json", `{"minecraft": {"environment": "dedicated_server"}}`, sideServer},
+		{"Forge client only", "META-INF/mods.toml", "modLoader=\"javafml\"\nclientSideOnly = true\n", sideClient},
+		{"NeoForge both", "META-INF/neoforge.mods.toml", "clientSideOnly=false\n", sideBoth},
+		{"Forge undeclared", "META-INF/mods.toml", "modLoader=\"javafml\"\n", sideUnknown},
+		{"No metadata", "", "", sideUnknown},
+	} {
+		path := filepath.Join(dir, string(rune('a'+i))+".jar")
+		writeJar(t, path, tt.file, tt.content)
+		got, err := jarSide(path)
+		if err != nil {
+			t.Errorf("%s\nerr: %s", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s\nReturned: %s\nExpected: %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := jarSide(filepath.Join(dir, "missing.jar")); err == nil {
+		t.Error("Expected an error for a missing jar")
+	}
+}
+
+func TestAddSide(t *testing.T) {
+	fakeCurseForge(t, map[string]any{
+		"/v1/mods/1":       cfMod{ID: 1, Name: "A", Class: classMod},
+		"/v1/mods/1/files": []CfFile{{ID: 11, Name: "a.jar", SupportedVersions: []string{"1.20.1", "Client"}}},
+		"/v1/mods/2":       cfMod{ID: 2, Name: "B", Class: classMod},
+		"/v1/mods/2/files": []CfFile{{ID: 21, Name: "b.jar", SupportedVersions: []string{"1.20.1", "Server"}}},
+		"/v1/mods/3":       cfMod{ID: 3, Name: "C", Class: classMod},
+		"/v1/mods/3/files": []CfFile{{ID: 31, Name: "c.jar", SupportedVersions: []string{"1.20.1"}}},
+	})
+	c := newTestCli(t, "y")
+	for _, line := range []string{"add id 1", "add id 2", "add id 3"} {
+		if err := c.run(t, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		target side
+		want   []int
+	}{
+		{sideServer, []int{2, 3}},
+		{sideClient, []int{1, 3}},
+		{sideBoth, []int{1, 2, 3}},
+	} {
+		f, err := c.parseModFilter(tokenize("side " + tt.target.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []int
+		for _, i := range f.apply(c.mods) {
+			got = append(got, c.mods[i].Id)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("list side %s\nReturned: %v\nExpected: %v", tt.target, got, tt.want)
+		}
+	}
+}
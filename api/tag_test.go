@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestTagSeparators(t *testing.T) {
+	c := newTestCli(t, "y")
+	c.mods = []modEntry{{Id: 1, Name: "a.jar"}}
+
+	for _, line := range []string{`tag 1 "a,b"`, `tag 1 "a;b"`, `tag 1 " "`} {
+		if err := c.run(t, line); err == nil {
+			t.Errorf("%s\nExpected an error", line)
+		}
+	}
+	if err := c.run(t, "tag 1 client"); err != nil {
+		t.Fatal(err)
+	}
+	if tags := c.mods[0].Tags; len(tags) != 1 || tags[0] != "client" {
+		t.Errorf("Returned: %v\nExpected: [client]", tags)
+	}
+}
+
+func TestSearchTag(t *testing.T) {
+	routes := map[string]any{}
+	c := newTestCli(t, "y")
+	for id, name := range []string{"sodium", "lithium", "jei", "iris", "phosphor"} {
+		routes[fmt.Sprintf("/v1/mods/%d", id+1)] = cfMod{ID: id + 1, Name: name, Class: classMod}
+		m := modEntry{Id: id + 1, Name: name + ".jar"}
+		if name != "jei" {
+			m.Tags = []string{"perf"}
+		}
+		c.mods = append(c.mods, m)
+	}
+	fakeCurseForge(t, routes)
+
+	search := func(line string) []searchRecord {
+		var records []searchRecord
+		out := captureStdout(t, func() {
+			if err := c.run(t, line); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if err := json.Unmarshal([]byte(out), &records); err != nil {
+			t.Fatalf("%s\n%s: %s", line, err, out)
+		}
+		return records
+	}
+	check := func(line string, records []searchRecord, want ...int) {
+		t.Helper()
+		var got []int
+		for i, r := range records {
+			if r.Index != i+1 {
+				t.Errorf("%s\nResult %d has index %d", line, i+1, r.Index)
+			}
+			got = append(got, r.ID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s\nReturned: %v\nExpected: %v", line, got, want)
+		}
+	}
+
+	check("all", search(`search "" tag perf size 2 --json`), 1, 2)
+	check("next", search(`next --json`), 4, 5)
+	check("filter", search(`search "ium" tag perf --json`), 1, 2)
+	if err := c.run(t, "next"); err == nil {
+		t.Error("Expected the tagged results to fit in one page")
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWorldsSet(t *testing.T) {
+	c := newTestCli(t, "y")
+	c.mods = []modEntry{{Id: 1, Name: "a.jar"}, {Id: 4, Name: "d.zip", Class: classDatapack}}
+
+	for _, tt := range []struct {
+		line   string
+		worlds []string
+		fails  bool
+	}{
+		{`worlds set 4 "Survival" "Creative 2"`, []string{"Survival", "Creative 2"}, false},
+		{`worlds set 4 "../escape"`, []string{"Survival", "Creative 2"}, true},
+		{"worlds set 1", []string{"Survival", "Creative 2"}, true},
+		{"worlds set 4", nil, false},
+	} {
+		err := c.run(t, tt.line)
+		if (err != nil) != tt.fails {
+			t.Errorf("%s\nReturned: %v\nExpected failure: %v", tt.line, err, tt.fails)
+		}
+		if got := c.mods[1].Worlds; !slices.Equal(got, tt.worlds) {
+			t.Errorf("%s\nReturned: %v\nExpected: %v", tt.line, got, tt.worlds)
+		}
+	}
+	if len(c.undoOps) != 2 {
+		t.Errorf("Returned %d undo operations\nExpected one per successful worlds set", len(c.undoOps))
+	}
+}
+
+func TestDownloadDatapackWorlds(t *testing.T) {
+	fakeDownloads(t, map[string][]byte{"/d.zip": zipOf(t, "pack.mcmeta")})
+	c := newTestCli(t, "y")
+	if err := os.MkdirAll(filepath.Join("saves", "Survival", "datapacks"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join("saves", "Creative"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("saves", "Survival", "datapacks", "other.zip"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.mods = []modEntry{{Id: 4, Name: "d.zip", Class: classDatapack, Worlds: []string{"Survival", "Creative", "Missing"}, DownloadUrl: "https://example.com/d.zip"}}
+
+	out := captureStdout(t, func() {
+		if err := c.run(t, "download"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	for _, w := range []string{"Survival", "Creative"} {
+		if _, err := os.Stat(filepath.Join("saves", w, "datapacks", "d.zip")); err != nil {
+			t.Errorf("Expected d.zip in %s\nerr: %s", w, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("saves", "Missing")); err == nil {
+		t.Error("download created a world that didn't exist")
+	}
+	if !strings.Contains(out, "no such world") {
+		t.Errorf("Returned:\n%s\nExpected the missing world to be reported", out)
+	}
+
+	worlds, err := readWorlds(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"Creative": {"d.zip"}, "Survival": {"d.zip", "other.zip"}}
+	if len(worlds) != len(want) {
+		t.Fatalf("Returned %d worlds\nExpected: %d", len(worlds), len(want))
+	}
+	for _, w := range worlds {
+		if !slices.Equal(w.datapacks, want[w.name]) {
+			t.Errorf("World %s\nReturned: %v\nExpected: %v", w.name, w.datapacks, want[w.name])
+		}
+	}
+
+	out = captureStdout(t, func() {
+		if err := c.run(t, "worlds"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	for _, want := range []string{"other.zip (not in modlist)", "Missing", "d.zip (not downloaded)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("worlds\nReturned:\n%s\nExpected it to mention %q", out, want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package bitstream
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -126,3 +129,86 @@ func TestVariableLen(t *testing.T) {
 		t.Errorf("Failed to read bits after pascal string\nReturned: %d\nExpected: 5\nerr: %s", n, err)
 	}
 }
+
+func TestVarint(t *testing.T) {
+	var bs Bitstream
+	bs.WriteBits(1, 3)
+	unums := []uint64{0, 1, 127, 128, 300, 1 << 35, ^uint64(0)}
+	for _, n := range unums {
+		bs.WriteUvarint(n)
+	}
+	nums := []int64{0, -1, 63, -64, 1 << 40, -62135596800}
+	for _, n := range nums {
+		bs.WriteVarint(n)
+	}
+
+	b := 3
+	for i, exp := range unums {
+		n, err := bs.ReadUvarint(&b)
+		if err != nil || n != exp {
+			t.Errorf("ReadUvarint failed\nunums[%d]\nReturned: %d\nExpected: %d\nerr: %v", i, n, exp, err)
+		}
+	}
+	for i, exp := range nums {
+		n, err := bs.ReadVarint(&b)
+		if err != nil || n != exp {
+			t.Errorf("ReadVarint failed\nnums[%d]\nReturned: %d\nExpected: %d\nerr: %v", i, n, exp, err)
+		}
+	}
+
+	if _, err := bs.ReadUvarint(&b); err == nil {
+		t.Errorf("ReadUvarint past the end should fail")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	var bs Bitstream
+	long := strings.Repeat("1.20.10-snapshot ", 40)
+	strs := []string{"", "Sodium", long}
+	bs.WriteBits(3, 2)
+	for _, s := range strs {
+		bs.WriteString(s)
+	}
+
+	b := 2
+	for i, exp := range strs {
+		s, err := bs.ReadString(&b)
+		if err != nil || s != exp {
+			t.Errorf("ReadString failed\nstrs[%d]\nReturned: %#+v\nExpected: %#+v\nerr: %v", i, s, exp, err)
+		}
+	}
+
+	truncated := FromBuffer(bs.Bytes()[:len(bs.Bytes())-1])
+	b = 2
+	for range strs {
+		_, err := truncated.ReadString(&b)
+		if err != nil {
+			return
+		}
+	}
+	t.Errorf("ReadString on a truncated stream should fail")
+}
+
+func TestSaveToDisk(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "modlist")
+	if err := os.WriteFile(name, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var bs Bitstream
+	bs.WriteString("new")
+	if err := bs.SaveToDisk(name); err != nil {
+		t.Fatalf("SaveToDisk Error\nerr: %s", err)
+	}
+
+	ret, err := os.ReadFile(name)
+	if err != nil || string(ret) != string(bs.Bytes()) {
+		t.Errorf("SaveToDisk Failed\nReturned: %#+v\nExpected: %#+v\nerr: %v", ret, bs.Bytes(), err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+}
@@ -1,8 +1,11 @@
 package bitstream
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/fs"
+	"math/rand/v2"
 	"os"
 	"strings"
 )
@@ -147,6 +150,106 @@ func (bs *Bitstream) ReadPascalString(bitpos *int) (string, error) {
 	return s, nil
 }
 
+func (bs *Bitstream) WriteUvarint(n uint64) {
+	for _, b := range binary.AppendUvarint(nil, n) {
+		bs.WriteBits(int(b), 8)
+	}
+}
+
+func (bs *Bitstream) WriteVarint(n int64) {
+	for _, b := range binary.AppendVarint(nil, n) {
+		bs.WriteBits(int(b), 8)
+	}
+}
+
+// WriteBytes writes the length of p as a uvarint followed by its contents.
+func (bs *Bitstream) WriteBytes(p []byte) {
+	bs.WriteUvarint(uint64(len(p)))
+	for _, b := range p {
+		bs.WriteBits(int(b), 8)
+	}
+}
+
+func (bs *Bitstream) WriteString(s string) {
+	bs.WriteBytes([]byte(s))
+}
+
+func (bs *Bitstream) readVarintBytes(bitpos *int) ([]byte, error) {
+	var buf []byte
+	for {
+		if len(buf) == binary.MaxVarintLen64 {
+			return nil, errors.New("Varint overflows 64 bits")
+		}
+
+		b, err := bs.ReadBits(bitpos, 8)
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, byte(b))
+		if b < 0x80 {
+			return buf, nil
+		}
+	}
+}
+
+func (bs *Bitstream) ReadUvarint(bitpos *int) (uint64, error) {
+	buf, err := bs.readVarintBytes(bitpos)
+	if err != nil {
+		return 0, err
+	}
+
+	n, size := binary.Uvarint(buf)
+	if size <= 0 {
+		return 0, errors.New("Invalid uvarint")
+	}
+	return n, nil
+}
+
+func (bs *Bitstream) ReadVarint(bitpos *int) (int64, error) {
+	buf, err := bs.readVarintBytes(bitpos)
+	if err != nil {
+		return 0, err
+	}
+
+	n, size := binary.Varint(buf)
+	if size <= 0 {
+		return 0, errors.New("Invalid varint")
+	}
+	return n, nil
+}
+
+func (bs *Bitstream) ReadBytes(bitpos *int) ([]byte, error) {
+	n, err := bs.ReadUvarint(bitpos)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining := uint64(len(bs.buf)*8-*bitpos) / 8; n > remaining {
+		return nil, fmt.Errorf("Byte string of length %d exceeds the %d remaining bytes", n, remaining)
+	}
+
+	p := make([]byte, n)
+	for i := range p {
+		b, err := bs.ReadBits(bitpos, 8)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = byte(b)
+	}
+
+	return p, nil
+}
+
+func (bs *Bitstream) ReadString(bitpos *int) (string, error) {
+	p, err := bs.ReadBytes(bitpos)
+	return string(p), err
+}
+
+func (bs *Bitstream) Bytes() []byte {
+	return bs.buf
+}
+
 func turnOffLeft(n byte, c byte) byte {
 	return n & ((byte(0xFF) << c) >> c)
 }
@@ -155,8 +258,55 @@ func turnOffRight(n byte, c byte) byte {
 	return n & ((byte(0xFF) >> c) << c)
 }
 
+// SaveToDisk writes the stream to a temporary file next to name, syncs it and
+// renames it into place so a crash never leaves a partially written file. The
+// file keeps its mode, new files get 0666 less the umask.
 func (bs *Bitstream) SaveToDisk(name string) error {
-	return os.WriteFile(name, bs.buf, 0666)
+	perm := fs.FileMode(0666)
+	info, err := os.Stat(name)
+	if err == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	tmp, err := createTemp(name, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bs.buf); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if info != nil {
+		if err := os.Chmod(tmp.Name(), perm); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// createTemp is os.CreateTemp with a mode, which goes through the umask
+func createTemp(name string, perm fs.FileMode) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(fmt.Sprintf("%s.tmp%d", name, rand.Uint32()), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
 }
 
 func (bs Bitstream) String() string {
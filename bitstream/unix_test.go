@@ -0,0 +1,45 @@
+//go:build unix
+// +build unix
+
+package bitstream
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSaveToDiskMode(t *testing.T) {
+	dir := t.TempDir()
+	old := syscall.Umask(0022)
+	defer syscall.Umask(old)
+
+	var bs Bitstream
+	bs.WriteString("mode")
+	for _, tt := range []struct {
+		existing os.FileMode
+		expected os.FileMode
+	}{
+		{0, 0644},
+		{0600, 0600},
+		{0664, 0664},
+	} {
+		name := filepath.Join(dir, fmt.Sprintf("modlist%o", tt.existing))
+		if tt.existing != 0 {
+			if err := os.WriteFile(name, nil, tt.existing); err != nil {
+				t.Fatal(err)
+			}
+			os.Chmod(name, tt.existing)
+		}
+
+		if err := bs.SaveToDisk(name); err != nil {
+			t.Fatalf("SaveToDisk Error\nerr: %s", err)
+		}
+		info, err := os.Stat(name)
+		if err != nil || info.Mode().Perm() != tt.expected {
+			t.Errorf("SaveToDisk mode of %o\nReturned: %v\nExpected: %v\nerr: %v", tt.existing, info.Mode().Perm(), tt.expected, err)
+		}
+	}
+}
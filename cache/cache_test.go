@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	url    string
+	calls  int
+	client *http.Client
+	store  *Store
+}
+
+func newTestServer(t *testing.T, ttl time.Duration) *testServer {
+	ts := &testServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.calls++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, r.URL.Path+string(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	ts.url = srv.URL
+	ts.store = NewStore(t.TempDir(), 0, Rule{Name: "mods", Pattern: "/v1/mods/*", TTL: ttl})
+	ts.client = &http.Client{Transport: &Transport{Base: http.DefaultTransport, Store: ts.store}}
+	return ts
+}
+
+func (ts *testServer) do(t *testing.T, method, path, body string) string {
+	req, err := http.NewRequest(method, ts.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed\nerr: %s", err)
+	}
+	defer res.Body.Close()
+
+	ret, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Read failed\nerr: %s", err)
+	}
+	return string(ret)
+}
+
+func TestFreshHit(t *testing.T) {
+	ts := newTestServer(t, time.Hour)
+	for range 3 {
+		if ret := ts.do(t, "GET", "/v1/mods/1", ""); ret != "/v1/mods/1" {
+			t.Errorf("Body mismatch\nReturned: %#+v\nExpected: %#+v", ret, "/v1/mods/1")
+		}
+	}
+
+	if ts.calls != 1 {
+		t.Errorf("Network calls mismatch\nReturned: %d\nExpected: %d", ts.calls, 1)
+	}
+
+	stats, err := ts.store.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 || stats.Fresh != 1 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Stats mismatch\nReturned: %#+v", stats)
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	ts := newTestServer(t, time.Nanosecond)
+	ts.do(t, "GET", "/v1/mods/1", "")
+	if ret := ts.do(t, "GET", "/v1/mods/1", ""); ret != "/v1/mods/1" {
+		t.Errorf("Body mismatch after 304\nReturned: %#+v\nExpected: %#+v", ret, "/v1/mods/1")
+	}
+
+	stats, _ := ts.store.Stats()
+	if ts.calls != 2 || stats.Revalidated != 1 {
+		t.Errorf("Revalidation mismatch\ncalls: %d\nstats: %#+v", ts.calls, stats)
+	}
+}
+
+func TestBodyKey(t *testing.T) {
+	ts := newTestServer(t, time.Hour)
+	a := ts.do(t, "POST", "/v1/mods/1", "a")
+	b := ts.do(t, "POST", "/v1/mods/1", "b")
+	ts.do(t, "POST", "/v1/mods/1", "a")
+	if a == b || ts.calls != 2 {
+		t.Errorf("POST bodies should be cached separately\na: %#+v\nb: %#+v\ncalls: %d", a, b, ts.calls)
+	}
+}
+
+func TestUncachedEndpoint(t *testing.T) {
+	ts := newTestServer(t, time.Hour)
+	ts.do(t, "GET", "/v1/games", "")
+	ts.do(t, "GET", "/v1/games", "")
+	if ts.calls != 2 {
+		t.Errorf("Network calls mismatch\nReturned: %d\nExpected: %d", ts.calls, 2)
+	}
+
+	if n, err := ts.store.Clear(); err != nil || n != 0 {
+		t.Errorf("Clear mismatch\nReturned: %d %v\nExpected: 0", n, err)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	ts := newTestServer(t, time.Nanosecond)
+	ts.do(t, "GET", "/v1/mods/1", "")
+
+	ts.store.Offline = true
+	if ret := ts.do(t, "GET", "/v1/mods/1", ""); ret != "/v1/mods/1" || ts.calls != 1 {
+		t.Errorf("Offline should serve stale entries\nReturned: %#+v\ncalls: %d", ret, ts.calls)
+	}
+
+	_, err := ts.client.Get(ts.url + "/v1/mods/2")
+	if !errors.Is(err, ErrOffline) {
+		t.Errorf("Offline miss\nReturned: %v\nExpected: %v", err, ErrOffline)
+	}
+}
+
+func TestCorruptEntry(t *testing.T) {
+	ts := newTestServer(t, time.Hour)
+	ts.do(t, "GET", "/v1/mods/1", "")
+
+	req, _ := http.NewRequest("GET", ts.url+"/v1/mods/1", nil)
+	key, _ := Key(req)
+	if err := os.WriteFile(ts.store.entryPath(key), []byte(`{"key":`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if ret := ts.do(t, "GET", "/v1/mods/1", ""); ret != "/v1/mods/1" {
+			t.Errorf("Body mismatch\nReturned: %#+v\nExpected: %#+v", ret, "/v1/mods/1")
+		}
+	}
+	if ts.calls != 2 {
+		t.Errorf("A corrupt entry should be a miss that gets replaced\ncalls: %d", ts.calls)
+	}
+}
+
+func TestSaveFailure(t *testing.T) {
+	ts := newTestServer(t, time.Hour)
+	ts.store.Dir = filepath.Join(ts.store.Dir, "file")
+	if err := os.WriteFile(ts.store.Dir, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if ret := ts.do(t, "GET", "/v1/mods/1", ""); ret != "/v1/mods/1" {
+			t.Errorf("Body mismatch\nReturned: %#+v\nExpected: %#+v", ret, "/v1/mods/1")
+		}
+	}
+	if ts.calls != 2 {
+		t.Errorf("Network calls mismatch\nReturned: %d\nExpected: %d", ts.calls, 2)
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	dir := t.TempDir()
+	rule := Rule{Name: "mods", Pattern: "/v1/mods/*", TTL: time.Hour}
+	if err := NewStore(dir, 0, rule).SetTTL("mods", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := NewStore(dir, 0, rule).Rules[0].TTL; ttl != time.Minute {
+		t.Errorf("TTL mismatch\nReturned: %s\nExpected: %s", ttl, time.Minute)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmps) != 0 {
+		t.Errorf("Temporary files left behind: %v", tmps)
+	}
+}
+
+func TestConcurrentStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	store := NewStore(t.TempDir(), 0, Rule{Name: "mods", Pattern: "/v1/mods/*", TTL: time.Hour})
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport, Store: store}}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(fmt.Sprintf("%s/v1/mods/%d", srv.URL, i%4))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := stats.Hits + stats.Misses + stats.Revalidated; n != 20 {
+		t.Errorf("Requests counted mismatch\nReturned: %d\nExpected: %d", n, 20)
+	}
+}
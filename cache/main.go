@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const ttlFile = "ttl.json"
+const entryExt = ".entry"
+
+type Rule struct {
+	Name    string
+	Pattern string
+	TTL     time.Duration
+}
+
+type Stats struct {
+	Entries     int
+	Fresh       int
+	Bytes       int64
+	Hits        int
+	Misses      int
+	Revalidated int
+}
+
+var ErrOffline = errors.New("Not available offline")
+
+type Store struct {
+	Dir        string
+	Rules      []Rule
+	DefaultTTL time.Duration
+	Offline    bool
+	// counters are shared by every Transport on the store, which may run
+	// concurrently
+	hits        atomic.Int64
+	misses      atomic.Int64
+	revalidated atomic.Int64
+}
+
+type entry struct {
+	Key          string      `json:"key"`
+	Path         string      `json:"path"`
+	Stored       time.Time   `json:"stored"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"lastModified"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+func NewStore(dir string, defaultTTL time.Duration, rules ...Rule) *Store {
+	s := &Store{Dir: dir, Rules: rules, DefaultTTL: defaultTTL}
+	s.loadTTLs()
+	return s
+}
+
+// Key identifies a request by method and URL, plus a hash of the body for
+// requests that carry one.
+func Key(req *http.Request) (string, error) {
+	key := req.Method + " " + req.URL.String()
+	if req.Body == nil || req.Body == http.NoBody {
+		return key, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	return key + " " + hex.EncodeToString(sum[:]), nil
+}
+
+func (s *Store) TTL(path string) time.Duration {
+	for _, r := range s.Rules {
+		if matchPath(r.Pattern, path) {
+			return r.TTL
+		}
+	}
+	return s.DefaultTTL
+}
+
+func (s *Store) SetTTL(name string, ttl time.Duration) error {
+	for i := range s.Rules {
+		if s.Rules[i].Name == name {
+			s.Rules[i].TTL = ttl
+			return s.saveTTLs()
+		}
+	}
+
+	return fmt.Errorf("Unknown cache endpoint %#+v", name)
+}
+
+func (s *Store) Clear() (int, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*"+entryExt))
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (s *Store) Stats() (Stats, error) {
+	stats := Stats{Hits: int(s.hits.Load()), Misses: int(s.misses.Load()), Revalidated: int(s.revalidated.Load())}
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*"+entryExt))
+	if err != nil {
+		return stats, err
+	}
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		stats.Entries++
+		stats.Bytes += info.Size()
+
+		e, err := readEntry(p)
+		if err != nil {
+			continue
+		}
+		if time.Since(e.Stored) < s.TTL(e.Path) {
+			stats.Fresh++
+		}
+	}
+
+	return stats, nil
+}
+
+// load returns the entry stored under key. Entries that can't be read, like
+// ones torn by a crash, are misses and get replaced on the next save.
+func (s *Store) load(key string) *entry {
+	e, err := readEntry(s.entryPath(key))
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+// save writes e to a temporary file first so a failed write never leaves a
+// torn entry behind.
+func (s *Store) save(e *entry) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.entryPath(e.Key), data)
+}
+
+// writeFile replaces the file at path with data through a temporary file, so
+// a crash halfway through leaves the old file whole.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) entryPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+entryExt)
+}
+
+func (s *Store) loadTTLs() {
+	data, err := os.ReadFile(filepath.Join(s.Dir, ttlFile))
+	if err != nil {
+		return
+	}
+
+	var ttls map[string]time.Duration
+	if err := json.Unmarshal(data, &ttls); err != nil {
+		return
+	}
+
+	for i := range s.Rules {
+		if ttl, ok := ttls[s.Rules[i].Name]; ok {
+			s.Rules[i].TTL = ttl
+		}
+	}
+}
+
+func (s *Store) saveTTLs() error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	ttls := make(map[string]time.Duration, len(s.Rules))
+	for _, r := range s.Rules {
+		ttls[r.Name] = r.TTL
+	}
+
+	data, err := json.MarshalIndent(ttls, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(s.Dir, ttlFile), data)
+}
+
+func readEntry(path string) (*entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("Corrupt cache entry %s: %w", path, err)
+	}
+
+	return &e, nil
+}
+
+// matchPath compares slash separated segments where * matches any one segment.
+func matchPath(pattern, path string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	ss := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ps) != len(ss) {
+		return false
+	}
+
+	for i := range ps {
+		if ps[i] != "*" && ps[i] != ss[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type Transport struct {
+	Base  http.RoundTripper
+	Store *Store
+}
+
+// RoundTrip serves fresh entries from disk and revalidates stale ones. While
+// the store is offline any cached entry is served regardless of its age. The
+// cache is best effort: failing to store a response doesn't fail the request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ttl := t.Store.TTL(req.URL.Path)
+	if ttl <= 0 && !t.Store.Offline {
+		return t.Base.RoundTrip(req)
+	}
+
+	key, err := Key(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := t.Store.load(key)
+
+	if t.Store.Offline {
+		if cached == nil {
+			return nil, ErrOffline
+		}
+		t.Store.hits.Add(1)
+		return cached.response(req), nil
+	}
+
+	if cached != nil && time.Since(cached.Stored) < ttl {
+		t.Store.hits.Add(1)
+		return cached.response(req), nil
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	res, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	if cached != nil && res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		t.Store.revalidated.Add(1)
+		cached.Stored = time.Now()
+		t.Store.save(cached)
+		return cached.response(req), nil
+	}
+
+	t.Store.misses.Add(1)
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := &entry{
+		Key:          key,
+		Path:         req.URL.Path,
+		Stored:       time.Now(),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Status:       res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+	}
+
+	t.Store.save(e)
+	return res, nil
+}
+
+func (e *entry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
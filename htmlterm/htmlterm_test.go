@@ -0,0 +1,70 @@
+package htmlterm
+
+import "testing"
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		exp  string
+	}{
+		{"Plain", "Fixed a crash", "Fixed a crash"},
+		{"Paragraphs", "<p>First</p><p>Second\n  line</p>", "First\n\nSecond line"},
+		{"Breaks", "a<br>b<br/><br>c", "a\nb\n\nc"},
+		{"Entities", "<p>Fish &amp; chips&nbsp;&lt;3 &#8212; &quot;ok&quot;</p>", "Fish & chips <3 — \"ok\""},
+		{"Inline", "<p>Use <b>bold</b> and <a href=\"x\">links</a>.</p>", "Use bold and links."},
+		{"List", "<p>Changes:</p><ul><li>One</li><li>Two</li></ul><p>End</p>", "Changes:\n\n- One\n- Two\n\nEnd"},
+		{"Ordered", "<ol><li>One<li>Two</ol>", "1. One\n2. Two"},
+		{"Nested", "<ul><li>Fixes<ul><li>Crash</li><li>Leak</li></ul></li><li>Other</li></ul>", "- Fixes\n  - Crash\n  - Leak\n- Other"},
+		{"Pre", "<pre>if x {\n    y()\n}</pre>", "if x {\n    y()\n}"},
+		{"Quote", "<blockquote>Said <br>twice</blockquote>", "> Said\n> twice"},
+		{"Skip", "<style>p { color: red }</style><p>Shown</p><script>alert(1)</script>", "Shown"},
+		{"Unclosed", "<p>One<p>Two", "One\n\nTwo"},
+		{"Less than", "<p>1 < 2</p>", "1 < 2"},
+		{"Stray end tag", "<p>ok</p></b><p>more <b>x</b></p>", "ok\n\nmore x"},
+		{"Stray less than", "<p>5 < 6 and <b>bold</b></p>", "5 < 6 and bold"},
+		{"Mismatched", "<p>a <span>b</div> c</p>", "a b c"},
+		{"Unclosed inline", "<p><b>a</p><p>b</p>", "a\n\nb"},
+		{"Comment", "<p>a<!-- <b>hidden</b> -->b</p><!DOCTYPE html>", "ab"},
+		{"Attributes", `<p><a title='x > y' href=https://a.b>link</a> <img alt="A &amp; B"></p>`, "link [A & B]"},
+		{"Unterminated tag", "<p>a <b", "a <b"},
+		{"Raw script", "<script>if (a < b && c) {}</script>ok", "ok"},
+	}
+
+	for _, test := range tests {
+		ret := Text(test.src)
+		if ret != test.exp {
+			t.Errorf("%s Failed\nReturned: %q\nExpected: %q", test.name, ret, test.exp)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		width int
+		exp   string
+	}{
+		{"Heading", "<h2>Features</h2><p>Fast</p>", 0, "\x1b[1;38;5;214mFeatures\x1b[0m\n\nFast"},
+		{"Emphasis", "<p><b>Bold <i>both</i></b> plain</p>", 0, "\x1b[1mBold\x1b[0m \x1b[1;3mboth\x1b[0m plain"},
+		{"Code", "<p>Run <code>/fps</code></p><pre>a\n  b</pre>", 0, "Run \x1b[38;5;180m/fps\x1b[0m\n\n\x1b[38;5;180ma\x1b[0m\n\x1b[38;5;180m  b\x1b[0m"},
+		{"Link", `<a href="https://example.com/wiki">Wiki</a>`, 0, "\x1b[4;38;5;75mWiki\x1b[0m \x1b[38;5;248m(https://example.com/wiki)\x1b[0m"},
+		{"Bare link", `<a href="https://example.com">https://example.com</a>`, 0, "\x1b[4;38;5;75mhttps://example.com\x1b[0m"},
+		{"Linkout", `<a href="https://www.curseforge.com/linkout?remoteUrl=https%253a%252f%252fgithub.com%252fa%252fb">Source</a>`, 0, "\x1b[4;38;5;75mSource\x1b[0m \x1b[38;5;248m(https://github.com/a/b)\x1b[0m"},
+		{"Relative link", `<a href="/projects/x">X</a>`, 0, "\x1b[4;38;5;75mX\x1b[0m"},
+		{"Image", `<p><img src="a.png" alt="Banner"><img src="b.png"></p>`, 0, "\x1b[38;5;248m[Banner]\x1b[0m"},
+		{"Wrap", "<p>one two three four five six</p>", 10, "one two\nthree four\nfive six"},
+		{"Wrap list", "<ul><li>one two three four</li></ul>", 12, "- one two\n  three four"},
+		{"Wrap long word", "<p>a verylongwordhere b</p>", 6, "a\nverylongwordhere\nb"},
+		{"Unclosed style", "<p><b>a</p><p>b</p>", 0, "\x1b[1ma\x1b[0m\n\nb"},
+		{"Stray end style", "<p>a</b> <i>b</i></p>", 0, "a \x1b[3mb\x1b[0m"},
+	}
+
+	for _, test := range tests {
+		ret := Render(test.src, test.width)
+		if ret != test.exp {
+			t.Errorf("%s Failed\nReturned: %q\nExpected: %q", test.name, ret, test.exp)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Package htmlterm turns the HTML CurseForge serves for changelogs and
+// descriptions into text that reads well in a terminal.
+package htmlterm
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const RESET = "\x1b[0m"
+
+// SGR parameters of each kind of markup
+const (
+	styleHeading   = "1;38;5;214"
+	styleBold      = "1"
+	styleItalic    = "3"
+	styleUnderline = "4"
+	styleLink      = "4;38;5;75"
+	styleCode      = "38;5;180"
+	styleDim       = "38;5;248"
+)
+
+type list struct {
+	ordered bool
+	n       int
+}
+
+type link struct {
+	href string
+	text string
+}
+
+type style struct {
+	tag string
+	sgr string
+}
+
+// voidTags never have content or an end tag
+var voidTags = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+
+// implicitTags end an open element of the same kind when they start right in it
+var implicitTags = []string{"p", "li", "tr", "td", "th"}
+
+type renderer struct {
+	out      strings.Builder
+	elems    []string
+	color    bool
+	width    int
+	col      int
+	newlines int
+	prefix   []string
+	marker   string
+	lists    []list
+	links    []link
+	styles   []style
+	applied  string
+	breaks   int
+	line     bool
+	space    bool
+	pre      int
+	skip     int
+}
+
+// Text renders src as plain text. Blocks are separated by blank lines, list
+// items get a marker and are indented by nesting level, images are replaced
+// by their alt text and whitespace is collapsed outside of <pre>. Unknown tags
+// and end tags of elements that aren't open are left out.
+func Text(src string) string {
+	return render(src, false, 0)
+}
+
+// Render renders src like Text, styling headings, links, code and emphasis
+// with ANSI escape codes, showing where links go and wrapping lines at width
+// columns unless width is 0.
+func Render(src string, width int) string {
+	return render(src, true, width)
+}
+
+func render(src string, color bool, width int) string {
+	z := tokenizer{src: src}
+	r := renderer{color: color, width: width, line: true}
+	for t, ok := z.next(); ok; t, ok = z.next() {
+		switch t.kind {
+		case startTag:
+			r.open(t)
+		case endTag:
+			r.close(t.tag)
+		default:
+			if r.skip == 0 {
+				r.text(t.text)
+			}
+		}
+	}
+	r.setSGR("")
+
+	return strings.TrimRight(r.out.String(), " \n")
+}
+
+func (r *renderer) open(t token) {
+	if slices.Contains(implicitTags, t.tag) && len(r.elems) != 0 && r.elems[len(r.elems)-1] == t.tag {
+		r.close(t.tag)
+	}
+
+	r.start(t)
+	if !slices.Contains(voidTags, t.tag) {
+		r.elems = append(r.elems, t.tag)
+	}
+}
+
+// close ends the innermost open tag element along with every element still
+// open inside it. End tags of elements that aren't open are ignored.
+func (r *renderer) close(tag string) {
+	for i := len(r.elems) - 1; i >= 0; i-- {
+		if r.elems[i] != tag {
+			continue
+		}
+		for len(r.elems) > i {
+			last := r.elems[len(r.elems)-1]
+			r.elems = r.elems[:len(r.elems)-1]
+			r.end(last)
+		}
+		return
+	}
+}
+
+func (r *renderer) start(t token) {
+	tag := t.tag
+	switch tag {
+	case "script", "style", "head":
+		r.skip++
+	case "br":
+		r.breaks++
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.block(2)
+		r.styleOn(tag, styleHeading)
+	case "p", "table":
+		r.block(2)
+	case "div", "tr", "section", "article", "header", "footer":
+		r.block(1)
+	case "pre":
+		r.block(2)
+		r.pre++
+		r.styleOn(tag, styleCode)
+	case "blockquote":
+		r.block(2)
+		quote := "> "
+		if r.color {
+			quote = "\x1b[" + styleDim + "m│" + RESET + " "
+		}
+		r.prefix = append(r.prefix, quote)
+	case "hr":
+		r.block(2)
+		rule := "----"
+		if r.color && r.width != 0 {
+			rule = strings.Repeat("─", max(r.width-visibleLen(strings.Join(r.prefix, "")), 4))
+		}
+		r.styleOn(tag, styleDim)
+		r.write(rule)
+		r.styleOff(tag)
+		r.block(2)
+	case "ul", "ol":
+		r.block(r.listBreak())
+		r.lists = append(r.lists, list{ordered: tag == "ol"})
+		r.prefix = append(r.prefix, "  ")
+	case "li":
+		r.block(1)
+		r.marker = "- "
+		if len(r.lists) == 0 {
+			return
+		}
+		l := &r.lists[len(r.lists)-1]
+		l.n++
+		if l.ordered {
+			r.marker = fmt.Sprintf("%d. ", l.n)
+		}
+	case "td", "th":
+		r.space = true
+	case "b", "strong":
+		r.styleOn(tag, styleBold)
+	case "i", "em":
+		r.styleOn(tag, styleItalic)
+	case "u":
+		r.styleOn(tag, styleUnderline)
+	case "code", "kbd", "samp":
+		r.styleOn(tag, styleCode)
+	case "a":
+		r.links = append(r.links, link{href: t.attr("href")})
+		r.styleOn(tag, styleLink)
+	case "img":
+		if alt := strings.TrimSpace(t.attr("alt")); alt != "" {
+			r.styleOn(tag, styleDim)
+			r.text("[" + alt + "]")
+			r.styleOff(tag)
+		}
+	}
+}
+
+func (r *renderer) end(tag string) {
+	switch tag {
+	case "script", "style", "head":
+		r.skip = max(r.skip-1, 0)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.styleOff(tag)
+		r.block(2)
+	case "p", "table":
+		r.block(2)
+	case "div", "tr", "li", "section", "article", "header", "footer":
+		r.block(1)
+	case "pre":
+		r.styleOff(tag)
+		r.block(2)
+		r.pre = max(r.pre-1, 0)
+	case "blockquote":
+		r.block(2)
+		r.dedent()
+	case "ul", "ol":
+		if len(r.lists) != 0 {
+			r.lists = r.lists[:len(r.lists)-1]
+			r.dedent()
+		}
+		r.block(r.listBreak())
+	case "td", "th":
+		r.space = true
+	case "b", "strong", "i", "em", "u", "code", "kbd", "samp":
+		r.styleOff(tag)
+	case "a":
+		r.styleOff(tag)
+		if len(r.links) == 0 {
+			return
+		}
+		l := r.links[len(r.links)-1]
+		r.links = r.links[:len(r.links)-1]
+		if u := linkURL(l.href); r.color && u != "" && u != strings.TrimSpace(l.text) {
+			r.styleOn("url", styleDim)
+			r.space = true
+			r.write("(" + u + ")")
+			r.styleOff("url")
+		}
+	}
+}
+
+// linkURL returns where href leads if it is a web link. CurseForge sends
+// outside links through its linkout page with the target escaped twice.
+func linkURL(href string) string {
+	u, err := url.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	if strings.HasSuffix(u.Host, "curseforge.com") && u.Path == "/linkout" {
+		remote := u.Query().Get("remoteUrl")
+		if unescaped, err := url.QueryUnescape(remote); err == nil {
+			remote = unescaped
+		}
+		return remote
+	}
+
+	return href
+}
+
+// listBreak is the spacing around a list, which is tighter when it is nested in
+// another one.
+func (r *renderer) listBreak() int {
+	if len(r.lists) != 0 {
+		return 1
+	}
+	return 2
+}
+
+func (r *renderer) dedent() {
+	if len(r.prefix) != 0 {
+		r.prefix = r.prefix[:len(r.prefix)-1]
+	}
+}
+
+func (r *renderer) block(n int) {
+	r.breaks = max(r.breaks, n)
+}
+
+func (r *renderer) styleOn(tag, sgr string) {
+	r.styles = append(r.styles, style{tag, sgr})
+}
+
+func (r *renderer) styleOff(tag string) {
+	for i := len(r.styles) - 1; i >= 0; i-- {
+		if r.styles[i].tag == tag {
+			r.styles = slices.Delete(r.styles, i, i+1)
+			return
+		}
+	}
+}
+
+// sgr returns the escape code of every style in effect
+func (r *renderer) sgr() string {
+	if !r.color || len(r.styles) == 0 {
+		return ""
+	}
+
+	params := make([]string, len(r.styles))
+	for i, s := range r.styles {
+		params[i] = s.sgr
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+func (r *renderer) setSGR(sgr string) {
+	if sgr == r.applied {
+		return
+	}
+	if r.applied != "" {
+		r.out.WriteString(RESET)
+	}
+	r.out.WriteString(sgr)
+	r.applied = sgr
+}
+
+func (r *renderer) text(s string) {
+	if r.pre != 0 {
+		for i, l := range strings.Split(s, "\n") {
+			if i != 0 {
+				r.newline()
+			}
+			if l != "" {
+				r.write(l)
+			}
+		}
+		return
+	}
+
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			r.space = true
+		}
+		return
+	}
+
+	if strings.TrimLeft(s[:1], " \t\r\n") == "" {
+		r.space = true
+	}
+	for i, w := range words {
+		if i != 0 {
+			r.space = true
+		}
+		r.write(w)
+	}
+	if strings.TrimRight(s[len(s)-1:], " \t\r\n") == "" {
+		r.space = true
+	}
+}
+
+func (r *renderer) newline() {
+	r.setSGR("")
+	r.out.WriteByte('\n')
+	r.newlines++
+	r.line = true
+	r.space = false
+	r.col = 0
+}
+
+// write appends s to the output, first leaving the line breaks pending from
+// the blocks before it. Outside of <pre> it moves to the next line when s
+// doesn't fit in the width.
+func (r *renderer) write(s string) {
+	if r.out.Len() != 0 {
+		for n := min(r.breaks, 2) - r.newlines; n > 0; n-- {
+			r.newline()
+		}
+	}
+	r.breaks = 0
+
+	n := visibleLen(s)
+	if r.width != 0 && r.pre == 0 && !r.line && r.space && r.col+1+n > r.width {
+		r.newline()
+	}
+
+	if r.line {
+		r.setSGR("")
+		indent := r.indent()
+		r.out.WriteString(indent)
+		r.col = visibleLen(indent)
+		r.line = false
+		r.space = false
+	}
+	sgr := r.sgr()
+	if r.space {
+		// a space only takes the style of the words around it when they share it
+		if sgr != r.applied {
+			r.setSGR("")
+		}
+		r.out.WriteByte(' ')
+		r.col++
+		r.space = false
+	}
+
+	r.setSGR(sgr)
+	r.out.WriteString(s)
+	r.col += n
+	r.newlines = 0
+	if len(r.links) != 0 {
+		r.links[len(r.links)-1].text += s
+	}
+}
+
+// indent returns the prefix of a new line, with the marker of a list item in
+// place of its last level.
+func (r *renderer) indent() string {
+	levels := r.prefix
+	if r.marker != "" && len(levels) != 0 {
+		levels = levels[:len(levels)-1]
+	}
+
+	prefix := strings.Join(levels, "") + r.marker
+	r.marker = ""
+	return prefix
+}
+
+// visibleLen is the number of columns s takes, not counting escape codes
+func visibleLen(s string) int {
+	var n int
+	var esc bool
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			esc = true
+		case esc:
+			esc = r != 'm'
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,201 @@
+package htmlterm
+
+import (
+	"html"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	startTag
+	endTag
+)
+
+type attribute struct {
+	name  string
+	value string
+}
+
+type token struct {
+	kind  tokenKind
+	tag   string
+	attrs []attribute
+	text  string
+}
+
+// rawTags hold text that is never markup
+var rawTags = []string{"script", "style", "textarea", "title"}
+
+// tokenizer splits HTML into text and tags without ever failing. A "<" that
+// doesn't start a tag is text, comments and doctypes are dropped and
+// entities are decoded.
+type tokenizer struct {
+	src string
+	i   int
+	raw string
+}
+
+func (z *tokenizer) next() (token, bool) {
+	if z.raw != "" && z.i < len(z.src) {
+		return z.rawText(), true
+	}
+
+	for z.skipComment() {
+	}
+	if z.i >= len(z.src) {
+		return token{}, false
+	}
+
+	if z.src[z.i] == '<' {
+		if t, ok := z.tag(); ok {
+			return t, true
+		}
+	}
+
+	start := z.i
+	z.i++
+	for z.i < len(z.src) && z.src[z.i] != '<' {
+		z.i++
+	}
+	return token{kind: textToken, text: html.UnescapeString(z.src[start:z.i])}, true
+}
+
+// rawText returns the text up to the end tag of the raw element it is in
+func (z *tokenizer) rawText() token {
+	start := z.i
+	end := strings.Index(strings.ToLower(z.src[start:]), "</"+z.raw)
+	if end == -1 {
+		end = len(z.src) - start
+	}
+	z.i = start + end
+	z.raw = ""
+	return token{kind: textToken, text: z.src[start:z.i]}
+}
+
+// skipComment skips the comment or declaration, like a doctype, at z.i
+func (z *tokenizer) skipComment() bool {
+	rest := z.src[z.i:]
+	switch {
+	case strings.HasPrefix(rest, "<!--"):
+		end := strings.Index(rest[4:], "-->")
+		if end == -1 {
+			z.i = len(z.src)
+		} else {
+			z.i += 4 + end + 3
+		}
+	case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+		end := strings.IndexByte(rest, '>')
+		if end == -1 {
+			z.i = len(z.src)
+		} else {
+			z.i += end + 1
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// tag reads the tag at z.i, leaving z.i alone when there is none
+func (z *tokenizer) tag() (token, bool) {
+	rest := z.src[z.i:]
+	kind, start := startTag, 1
+	if strings.HasPrefix(rest, "</") {
+		kind, start = endTag, 2
+	}
+	if start >= len(rest) || !isLetter(rest[start]) {
+		return token{}, false
+	}
+
+	end := start
+	for end < len(rest) && isNameByte(rest[end]) {
+		end++
+	}
+	t := token{kind: kind, tag: strings.ToLower(rest[start:end])}
+
+	j, ok := t.readAttrs(rest, end)
+	if !ok {
+		return token{}, false
+	}
+	z.i += j
+	if kind == startTag {
+		for _, raw := range rawTags {
+			if t.tag == raw {
+				z.raw = raw
+			}
+		}
+	}
+	return t, true
+}
+
+// readAttrs reads the attributes of the tag in s from i up to its closing ">"
+// and returns where the tag ends.
+func (t *token) readAttrs(s string, i int) (int, bool) {
+	for {
+		for i < len(s) && (isSpace(s[i]) || s[i] == '/') {
+			i++
+		}
+		if i >= len(s) {
+			return 0, false
+		}
+		if s[i] == '>' {
+			return i + 1, true
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		a := attribute{name: strings.ToLower(s[start:i])}
+
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end == -1 {
+					return 0, false
+				}
+				a.value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				a.value = s[start:i]
+			}
+		}
+
+		a.value = html.UnescapeString(a.value)
+		t.attrs = append(t.attrs, a)
+	}
+}
+
+func (t token) attr(name string) string {
+	for _, a := range t.attrs {
+		if a.name == name {
+			return a.value
+		}
+	}
+	return ""
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isNameByte(b byte) bool {
+	return isLetter(b) || (b >= '0' && b <= '9') || b == '-' || b == ':'
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
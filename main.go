@@ -1,13 +1,32 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/stuff7/mcman/api"
 )
 
 func main() {
-	if err := api.NewCli("> ").Run(); err != nil {
+	offline := flag.Bool("offline", false, "Serve everything from the local cache and queue network-only commands")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-offline] [command...]\n\nWith a command, runs it and exits instead of starting the prompt.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cli := api.NewCli("> ")
+	cli.SetOffline(*offline)
+	if flag.NArg() > 0 {
+		if err := cli.RunOnce(flag.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := cli.Run(); err != nil {
 		fmt.Printf("Error: %#+v\n", err)
 	}
 }
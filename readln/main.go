@@ -20,6 +20,7 @@ const (
 	CtrlArrowRight
 	CtrlArrowLeft
 	Backspace
+	CtrlC
 )
 
 func PushLn(prompt string, history *[]string, promptHl func(Key, *string, *int) string) (string, error) {
@@ -47,6 +48,9 @@ func PushLn(prompt string, history *[]string, promptHl func(Key, *string, *int)
 			if hpos < len(*history) {
 				hpos++
 			}
+		case CtrlC:
+			newBuf = ""
+			hpos = len(*history)
 		default:
 			continue
 		}
@@ -96,12 +100,32 @@ func ReadLn(prompt string, buf *string) error {
 
 func promptLn(prompt string, input string, cursor int) {
 	fmt.Printf("\x1b[2K\r%s%s", prompt, input)
-	cursor += len(prompt)
+	cursor += visibleLen(prompt)
 	if cursor > 0 {
 		fmt.Printf("\r\x1b[%dC", cursor)
 	}
 }
 
+// visibleLen counts the runes of s that take up space in the terminal, skipping
+// ANSI escape sequences.
+func visibleLen(s string) int {
+	var n int
+	var inEsc bool
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEsc = true
+		case inEsc:
+			if r >= 0x40 && r <= 0x7E && r != '[' {
+				inEsc = false
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
 func ReadCh(s *string, pos *int) (Key, error) {
 	buf := []byte(*s)
 	key, ch, err := readKey()
@@ -126,6 +150,9 @@ func ReadCh(s *string, pos *int) (Key, error) {
 		*pos = max(0, *pos-1)
 	case ArrowRight:
 		*pos = min(len(buf), *pos+1)
+	case CtrlC:
+		buf = nil
+		*pos = 0
 	case CtrlBackspace:
 		idx := *pos
 		for idx > 0 && IsSpace((buf)[idx-1]) {
@@ -17,6 +17,8 @@ func readKey() (Key, byte, error) {
 
 	key := NA
 	switch ch {
+	case 3:
+		key = CtrlC
 	case 8, 23:
 		key = CtrlBackspace
 	case 9:
@@ -74,6 +76,8 @@ func parseEscSeq() (Key, error) {
 	return 0, nil
 }
 
+var original *syscall.Termios
+
 func getch() (byte, error) {
 	var buf [1]byte
 	var old syscall.Termios
@@ -82,7 +86,13 @@ func getch() (byte, error) {
 		return 0, err
 	}
 
-	old.Lflag &^= syscall.ICANON | syscall.ECHO
+	if original == nil {
+		saved := old
+		original = &saved
+	}
+
+	// ISIG is turned off so Ctrl+C reaches the prompt as a key instead of a SIGINT
+	old.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
 	old.Cc[syscall.VMIN] = 1
 	old.Cc[syscall.VTIME] = 0
 
@@ -96,7 +106,7 @@ func getch() (byte, error) {
 		return 0, err
 	}
 
-	old.Lflag |= syscall.ICANON | syscall.ECHO
+	old.Lflag |= syscall.ICANON | syscall.ECHO | syscall.ISIG
 	_, _, err = syscall.Syscall(syscall.SYS_IOCTL, uintptr(syscall.Stdin), uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(&old)))
 	if err != 0 {
 		return 0, err
@@ -104,3 +114,30 @@ func getch() (byte, error) {
 
 	return buf[0], nil
 }
+
+// Restore puts the terminal back into the state it was in before the first
+// key was read.
+func Restore() error {
+	if original == nil {
+		return nil
+	}
+
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, uintptr(syscall.Stdin), uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(original)))
+	if err != 0 {
+		return err
+	}
+
+	return nil
+}
+
+// Width returns the number of columns of the terminal, or 80 when stdout isn't
+// one.
+func Width() int {
+	var ws struct{ row, col, x, y uint16 }
+	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, uintptr(syscall.Stdout), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if err != 0 || ws.col == 0 {
+		return 80
+	}
+
+	return int(ws.col)
+}